@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/fmotalleb/timber/server/auth/passwd"
+)
+
+// passwdCmd generates password hashes accepted by the auth middleware.
+var passwdCmd = &cobra.Command{
+	Use:     "passwd",
+	Aliases: []string{"hash-password"},
+	Short:   "Generate a password hash for the users config",
+	Long: `Reads a password from stdin (or prompts for it on a terminal) and prints its hash.
+
+The printed hash has every '$' escaped as '$$' so it can be pasted into the
+config file as-is, since config values are env-substituted. Use --raw to print
+the hash unescaped. When --user is given a complete users entry is printed:
+
+  timber passwd -u admin -g all_logs,app_logs
+  admin:$$2a$$10$$...@all_logs,app_logs`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		flags := cmd.Flags()
+		algo, err := flags.GetString("algo")
+		if err != nil {
+			return err
+		}
+		user, err := flags.GetString("user")
+		if err != nil {
+			return err
+		}
+		access, err := flags.GetStringSlice("access")
+		if err != nil {
+			return err
+		}
+		raw, err := flags.GetBool("raw")
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(user, ":@") {
+			return errors.New("user name must not contain ':' or '@'")
+		}
+
+		password, err := readPassword(cmd.InOrStdin(), cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		hash, err := passwd.Hash(passwd.Algorithm(algo), password)
+		if err != nil {
+			return fmt.Errorf("hash password: %w", err)
+		}
+		if !raw {
+			hash = strings.ReplaceAll(hash, "$", "$$")
+		}
+
+		out := cmd.OutOrStdout()
+		if user == "" {
+			_, err = fmt.Fprintln(out, hash)
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s:%s@%s\n", user, hash, strings.Join(access, ","))
+		return err
+	},
+}
+
+// readPassword prompts for the password twice on a terminal, otherwise reads the first line of in.
+func readPassword(in io.Reader, prompt io.Writer) (string, error) {
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fd := int(f.Fd())
+		_, _ = fmt.Fprint(prompt, "Password: ")
+		first, err := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(prompt)
+		if err != nil {
+			return "", err
+		}
+		_, _ = fmt.Fprint(prompt, "Confirm password: ")
+		second, err := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(prompt)
+		if err != nil {
+			return "", err
+		}
+		if string(first) != string(second) {
+			return "", errors.New("passwords do not match")
+		}
+		if len(first) == 0 {
+			return "", errors.New("password must not be empty")
+		}
+		return string(first), nil
+	}
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return line, nil
+}
+
+func init() {
+	passwdCmd.Flags().StringP(
+		"algo", "a", string(passwd.Bcrypt),
+		fmt.Sprintf("hash algorithm (%s, %s, %s)", passwd.Bcrypt, passwd.Argon2id, passwd.SHA512Crypt),
+	)
+	passwdCmd.Flags().StringP("user", "u", "", "print a complete user:hash@access entry for this user")
+	passwdCmd.Flags().StringSliceP("access", "g", nil, "access groups of the printed user entry")
+	passwdCmd.Flags().Bool("raw", false, "do not escape '$' in the printed hash")
+	rootCmd.AddCommand(passwdCmd)
+}
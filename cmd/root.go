@@ -56,6 +56,8 @@ to quickly create a Cobra application.`,
 		reload := make(chan os.Signal, signalBufferSize)
 		signal.Notify(reload, syscall.SIGHUP, os.Interrupt)
 		defer signal.Stop(reload)
+		srv := server.NewServer(ctx)
+		defer srv.Close()
 		err = reloader.WithReload(
 			ctx,
 			reload,
@@ -65,7 +67,7 @@ to quickly create a Cobra application.`,
 					return err
 				}
 				sCtx := server.NewContext(ctx, cfg)
-				return server.Serve(sCtx)
+				return srv.Serve(sCtx)
 			},
 			reloadTimeout,
 		)
@@ -8,8 +8,32 @@ import (
 )
 
 // Access defines the files and directories that a user can access.
+// Paths prefixed with `!` are treated as deny patterns, same as entries of Deny.
+// Symlinks are only followed when FollowSymlinks is set, and their target must
+// be accessible as well.
+// Ops limits the allowed operations (ls, cat, head, tail, follow, download, range,
+// grep, parse); empty allows all.
+// Parser names the parser of the group's files (regex with Pattern), detected when empty.
 type Access struct {
-	Paths []string `mapstructure:"path"`
+	Paths          []string `mapstructure:"path"`
+	Deny           []string `mapstructure:"deny"`
+	Ops            []string `mapstructure:"ops"`
+	FollowSymlinks bool     `mapstructure:"follow_symlinks"`
+	Parser         string   `mapstructure:"parser"`
+	Pattern        string   `mapstructure:"pattern"`
+}
+
+// Patterns splits the access into allow and deny patterns.
+func (a Access) Patterns() (allow []string, deny []string) {
+	for _, p := range a.Paths {
+		if neg, ok := strings.CutPrefix(p, "!"); ok {
+			deny = append(deny, neg)
+			continue
+		}
+		allow = append(allow, p)
+	}
+	deny = append(deny, a.Deny...)
+	return allow, deny
 }
 
 // Decode is a custom decoder for the Access type to handle both string and slice of strings.
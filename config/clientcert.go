@@ -0,0 +1,14 @@
+package config
+
+// ClientCert maps a verified client certificate to a timber identity.
+// It matches when CN equals the subject common name and SAN equals one of the
+// subject alternative names (DNS, email, IP or URI); an empty field matches
+// anything, but at least one must be set.
+// A match authenticates as User, or as the certificate's name when User is empty,
+// with AccessList added to the user's access groups.
+type ClientCert struct {
+	CN         string   `mapstructure:"cn"`
+	SAN        string   `mapstructure:"san"`
+	User       string   `mapstructure:"user"`
+	AccessList []string `mapstructure:"access"`
+}
@@ -1,8 +1,28 @@
 package config
 
+import "strings"
+
 // Config is the root configuration for the application.
 type Config struct {
-	Listen string            `mapstructure:"listen" env:"LISTEN" default:"127.0.0.1:8080"`
-	Users  []User            `mapstructure:"users"`
-	Access map[string]Access `mapstructure:"access"`
+	Listen         string            `mapstructure:"listen" env:"LISTEN" default:"127.0.0.1:8080"`
+	Listeners      []Listener        `mapstructure:"listeners"`
+	BasePath       string            `mapstructure:"base_path" env:"BASE_PATH"`
+	TrustedProxies []string          `mapstructure:"trusted_proxies"`
+	TLS            TLS               `mapstructure:"tls"`
+	Users          []User            `mapstructure:"users"`
+	Tokens         []Token           `mapstructure:"tokens"`
+	ClientCerts    []ClientCert      `mapstructure:"client_certs"`
+	Access         map[string]Access `mapstructure:"access"`
+	Session        Session           `mapstructure:"session"`
+	Lockout        Lockout           `mapstructure:"lockout"`
+	OIDC           OIDC              `mapstructure:"oidc"`
+}
+
+// Prefix returns BasePath as a URL prefix: empty, or starting but not ending with a slash.
+func (c Config) Prefix() string {
+	p := strings.Trim(c.BasePath, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
 }
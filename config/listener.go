@@ -0,0 +1,17 @@
+package config
+
+// Listener is an additional address the server listens on.
+// Address is a TCP address or a Unix domain socket such as `unix:///run/timber.sock`,
+// whose file gets Mode (octal) and, optionally, Owner and Group.
+// TCP listeners serve HTTPS when TLS is enabled, unless Plaintext is set.
+// Auth limits the accepted authentication methods (as reported by /me), and
+// User authenticates every request on the listener as that user without credentials.
+type Listener struct {
+	Address   string   `mapstructure:"address"`
+	Mode      string   `mapstructure:"mode" default:"0660"`
+	Owner     string   `mapstructure:"owner"`
+	Group     string   `mapstructure:"group"`
+	Plaintext bool     `mapstructure:"plaintext"`
+	Auth      []string `mapstructure:"auth"`
+	User      string   `mapstructure:"user"`
+}
@@ -0,0 +1,22 @@
+package config
+
+import "time"
+
+// Lockout configures brute-force protection of the password and token authenticators.
+// Every failure blocks further attempts of the same user name or client IP for
+// BaseDelay, doubling with each consecutive failure. After MaxFailures (per user)
+// or MaxIPFailures (per client IP) the key is locked out for Duration.
+// Failures are forgotten after ResetAfter without new failures.
+// Zero values are replaced by defaults, so a negative MaxFailures disables it.
+type Lockout struct {
+	MaxFailures   int           `mapstructure:"max_failures" default:"5"`
+	MaxIPFailures int           `mapstructure:"max_ip_failures" default:"20"`
+	BaseDelay     time.Duration `mapstructure:"base_delay" default:"1s"`
+	Duration      time.Duration `mapstructure:"duration" default:"15m"`
+	ResetAfter    time.Duration `mapstructure:"reset_after" default:"15m"`
+}
+
+// Enabled reports whether brute-force protection is active.
+func (l Lockout) Enabled() bool {
+	return l.MaxFailures > 0
+}
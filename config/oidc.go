@@ -0,0 +1,22 @@
+package config
+
+// OIDC configures OpenID Connect authorization-code login for the web UI.
+// It is enabled when Issuer is set.
+// Groups maps values of the GroupsClaim to timber access groups, and Access
+// lists access groups granted to every user of the provider.
+type OIDC struct {
+	Issuer        string              `mapstructure:"issuer"`
+	ClientID      string              `mapstructure:"client_id"`
+	ClientSecret  string              `mapstructure:"client_secret"`
+	RedirectURL   string              `mapstructure:"redirect_url"`
+	Scopes        []string            `mapstructure:"scopes"`
+	UsernameClaim string              `mapstructure:"username_claim" default:"preferred_username"`
+	GroupsClaim   string              `mapstructure:"groups_claim" default:"groups"`
+	Groups        map[string][]string `mapstructure:"groups"`
+	Access        []string            `mapstructure:"access"`
+}
+
+// Enabled reports whether OIDC login is configured.
+func (o OIDC) Enabled() bool {
+	return o.Issuer != ""
+}
@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// Session configures the signed session cookie used by browser logins.
+// When Secret is empty a random key is generated, so sessions do not survive restarts.
+// Sessions end after Lifetime, or earlier when unused for IdleTimeout.
+// Zero values are replaced by defaults, so a negative IdleTimeout disables it.
+// Changing Epoch invalidates every session issued before.
+type Session struct {
+	Secret      string        `mapstructure:"secret" env:"SESSION_SECRET"`
+	CookieName  string        `mapstructure:"cookie_name" default:"timber_session"`
+	Lifetime    time.Duration `mapstructure:"lifetime" default:"12h"`
+	IdleTimeout time.Duration `mapstructure:"idle_timeout" default:"30m"`
+	Epoch       int           `mapstructure:"epoch"`
+}
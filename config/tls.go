@@ -0,0 +1,26 @@
+package config
+
+import "time"
+
+// TLS configures the native HTTPS listener.
+// It is enabled when Cert and Key are set. ClientCA is a PEM bundle of
+// certificate authorities trusted to sign client certificates; when set, client
+// certificates are verified and, with RequireClientCert, mandatory.
+// Ciphers lists TLS 1.0-1.2 cipher suite names (TLS 1.3 suites are not configurable).
+// The certificate files are checked for changes every ReloadInterval, and
+// RedirectListen optionally serves plain HTTP redirects to the HTTPS listener.
+type TLS struct {
+	Cert              string        `mapstructure:"cert" env:"TLS_CERT"`
+	Key               string        `mapstructure:"key" env:"TLS_KEY"`
+	MinVersion        string        `mapstructure:"min_version" default:"1.2"`
+	Ciphers           []string      `mapstructure:"ciphers"`
+	ClientCA          string        `mapstructure:"client_ca"`
+	RequireClientCert bool          `mapstructure:"require_client_cert"`
+	ReloadInterval    time.Duration `mapstructure:"reload_interval" default:"10s"`
+	RedirectListen    string        `mapstructure:"redirect_listen"`
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (t TLS) Enabled() bool {
+	return t.Cert != "" && t.Key != ""
+}
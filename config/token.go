@@ -0,0 +1,12 @@
+package config
+
+import "time"
+
+// Token is an API token for machine clients, sent as `Authorization: Bearer <name>.<secret>`.
+// Secret is hashed the same way as User.Password, and Expires is optional.
+type Token struct {
+	Name       string    `mapstructure:"name"`
+	Secret     string    `mapstructure:"secret"`
+	AccessList []string  `mapstructure:"access"`
+	Expires    time.Time `mapstructure:"expires"`
+}
@@ -7,6 +7,9 @@ import (
 )
 
 // User represents a user with their credentials and access rights.
+// Password is either plaintext or a bcrypt, argon2id or SHA-512-crypt hash,
+// detected by its prefix. Since config values are env-substituted, `$` in
+// hashes must be escaped as `$$`.
 type User struct {
 	Name       string   `mapstructure:"name"`
 	Password   string   `mapstructure:"password"`
@@ -14,7 +17,7 @@ type User struct {
 }
 
 // Decode is a custom decoder for the User type to handle string format.
-// The format is <user>:<pass>@<access-1>,<access-2>.
+// The format is <user>:<pass>@<access-1>,<access-2>, where <pass> may be a password hash.
 func (u *User) Decode(from reflect.Type, val interface{}) (any, error) {
 	if from.Kind() != reflect.String {
 		return val, nil
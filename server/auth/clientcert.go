@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+	"slices"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/config"
+)
+
+// MethodCert is reported in AuthUser.Method for client-certificate authentication.
+const MethodCert = "cert"
+
+// WithClientCert is a middleware that authenticates verified TLS client certificates
+// through the configured client certificate mappings.
+// Requests without a verified certificate, or whose certificate has no mapping,
+// and requests already authenticated are passed through to the next authenticator.
+func WithClientCert(cfg config.Config) func(http.Handler) http.Handler {
+	users := newUserIndex(cfg)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := UserFromContext(r.Context()); ok || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			logger := log.Of(r.Context())
+			cert := r.TLS.VerifiedChains[0][0]
+
+			m, ok := matchClientCert(cfg.ClientCerts, cert)
+			if !ok {
+				logger.Warn("no mapping for client certificate", zap.String("subject", cert.Subject.String()))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			authUser := &AuthUser{
+				Name:   certName(m, cert),
+				Method: MethodCert,
+			}
+			accessList := m.AccessList
+			if m.User != "" {
+				u, ok := users[m.User]
+				if !ok {
+					logger.Warn("client certificate mapped to unknown user", zap.String("user", m.User))
+					next.ServeHTTP(w, r)
+					return
+				}
+				accessList = append(slices.Clone(u.AccessList), m.AccessList...)
+			}
+			next.ServeHTTP(w, withUser(r, authUser, resolveAccess(cfg, accessList)))
+		})
+	}
+}
+
+// matchClientCert returns the first mapping matching the certificate.
+func matchClientCert(mappings []config.ClientCert, cert *x509.Certificate) (config.ClientCert, bool) {
+	for _, m := range mappings {
+		if m.CN == "" && m.SAN == "" {
+			continue
+		}
+		if m.CN != "" && m.CN != cert.Subject.CommonName {
+			continue
+		}
+		if m.SAN != "" && !slices.Contains(certSANs(cert), m.SAN) {
+			continue
+		}
+		return m, true
+	}
+	return config.ClientCert{}, false
+}
+
+// certName returns the name a matched certificate authenticates as.
+func certName(m config.ClientCert, cert *x509.Certificate) string {
+	switch {
+	case m.User != "":
+		return m.User
+	case m.CN != "":
+		return m.CN
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	default:
+		return m.SAN
+	}
+}
+
+// certSANs lists the subject alternative names of the certificate.
+func certSANs(cert *x509.Certificate) []string {
+	sans := slices.Concat(cert.DNSNames, cert.EmailAddresses)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
@@ -3,6 +3,7 @@ package auth
 
 import (
 	"context"
+	"net/http"
 )
 
 type ctxKey string
@@ -12,10 +13,20 @@ const (
 	ctxAccessKey ctxKey = "auth.access"
 )
 
+// Authentication methods reported in AuthUser.Method.
+const (
+	MethodBasic    = "basic"
+	MethodToken    = "token"
+	MethodPassword = "password"
+)
+
 // AuthUser represents the authenticated user.
 type AuthUser struct {
 	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Token  string   `json:"token,omitempty"`
 	Access []string `json:"access"`
+	Deny   []string `json:"deny,omitempty"`
 }
 
 // UserFromContext returns the authenticated user from the context.
@@ -24,8 +35,17 @@ func UserFromContext(ctx context.Context) (*AuthUser, bool) {
 	return u, ok
 }
 
-// AccessFromContext returns the access rights of the authenticated user from the context.
-func AccessFromContext(ctx context.Context) ([]string, bool) {
-	a, ok := ctx.Value(ctxAccessKey).([]string)
+// AccessFromContext returns the access rules of the authenticated user from the context.
+func AccessFromContext(ctx context.Context) (Rules, bool) {
+	a, ok := ctx.Value(ctxAccessKey).(Rules)
 	return a, ok
 }
+
+// withUser returns a shallow copy of r carrying the authenticated user and its access rules.
+func withUser(r *http.Request, user *AuthUser, access Rules) *http.Request {
+	user.Access = access.Allow()
+	user.Deny = access.Deny()
+	ctx := context.WithValue(r.Context(), ctxUserKey, user)
+	ctx = context.WithValue(ctx, ctxAccessKey, access)
+	return r.WithContext(ctx)
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/config"
+	"github.com/fmotalleb/timber/server/response"
+)
+
+// maxBackoffShift caps the exponent of the backoff so the delay cannot overflow.
+const maxBackoffShift = 30
+
+// attempts tracks the failures of a single user name, token name or client IP,
+// and its attempts that are still being verified.
+type attempts struct {
+	failures int
+	pending  int
+	last     time.Time
+	until    time.Time
+}
+
+// Limiter counts authentication failures per user or token name and client IP
+// and blocks further attempts with exponential backoff and a temporary lockout.
+// Attempts are reserved before the credentials are verified, so that parallel
+// attempts can not get past the limits either.
+type Limiter struct {
+	mu        sync.Mutex
+	cfg       config.Lockout
+	entries   map[string]*attempts
+	lastSweep time.Time
+}
+
+// NewLimiter creates a limiter from the config.
+func NewLimiter(cfg config.Lockout) *Limiter {
+	return &Limiter{
+		cfg:       cfg,
+		entries:   make(map[string]*attempts),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetConfig replaces the config, e.g. on reload, keeping the recorded failures.
+func (l *Limiter) SetConfig(cfg config.Lockout) {
+	l.mu.Lock()
+	l.cfg = cfg
+	l.mu.Unlock()
+}
+
+// limit is the maximum number of failures of a limiter key.
+type limit struct {
+	key string
+	max int
+}
+
+// limits returns the keys of an attempt of key from the client IP of r.
+func (l *Limiter) limits(r *http.Request, key string) []limit {
+	return []limit{
+		{key, l.cfg.MaxFailures},
+		{ipKey(r), l.cfg.MaxIPFailures},
+	}
+}
+
+// guard checks whether key, made by userKey or tokenKey, and the client IP of
+// r may attempt to authenticate, and reserves the attempt. Each reserved
+// attempt must be ended by fail or succeed. Attempts are blocked during the
+// backoff, and while the pending ones could reach the maximum failures.
+// When they are blocked, it writes a 429 response and returns false.
+func (l *Limiter) guard(w http.ResponseWriter, r *http.Request, key string) bool {
+	now := time.Now()
+	var wait time.Duration
+	l.mu.Lock()
+	if !l.cfg.Enabled() {
+		l.mu.Unlock()
+		return true
+	}
+	limits := l.limits(r, key)
+	for _, k := range limits {
+		a, ok := l.entries[k.key]
+		switch {
+		case !ok:
+		case now.Before(a.until):
+			wait = max(wait, a.until.Sub(now))
+		case a.pending > 0 && a.recent(now, l.cfg.ResetAfter)+a.pending >= k.max:
+			wait = max(wait, l.cfg.BaseDelay)
+		}
+	}
+	if wait == 0 {
+		for _, k := range limits {
+			a, ok := l.entries[k.key]
+			if !ok {
+				a = &attempts{}
+				l.entries[k.key] = a
+			}
+			a.pending++
+		}
+	}
+	l.mu.Unlock()
+	if wait == 0 {
+		return true
+	}
+	log.Of(r.Context()).Warn(
+		"authentication attempt blocked",
+		zap.String("key", key),
+		zap.String("client_ip", clientIP(r)),
+		zap.Duration("retry_after", wait),
+	)
+	response.TooManyRequests(w, wait)
+	return false
+}
+
+// fail records the failure of an attempt reserved by guard.
+func (l *Limiter) fail(r *http.Request, key string) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.cfg.Enabled() {
+		return
+	}
+	l.sweep(now)
+
+	for _, k := range l.limits(r, key) {
+		a, ok := l.entries[k.key]
+		if !ok {
+			a = &attempts{}
+			l.entries[k.key] = a
+		}
+		a.pending = max(a.pending-1, 0)
+		a.failures = a.recent(now, l.cfg.ResetAfter) + 1
+		a.last = now
+		if a.failures < k.max {
+			a.until = now.Add(min(l.cfg.BaseDelay<<min(a.failures-1, maxBackoffShift), l.cfg.Duration))
+			continue
+		}
+		a.until = now.Add(l.cfg.Duration)
+		if a.failures == k.max {
+			log.Of(r.Context()).Warn(
+				"authentication locked out",
+				zap.String("key", k.key),
+				zap.Int("failures", a.failures),
+				zap.Time("until", a.until),
+			)
+		}
+	}
+}
+
+// succeed ends an attempt reserved by guard and forgets the failures of key;
+// client IP failures decay on their own.
+func (l *Limiter) succeed(r *http.Request, key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.cfg.Enabled() {
+		return
+	}
+	for _, k := range l.limits(r, key) {
+		a, ok := l.entries[k.key]
+		if !ok {
+			continue
+		}
+		a.pending = max(a.pending-1, 0)
+		if k.key == key {
+			a.failures, a.until = 0, time.Time{}
+		}
+		if a.pending == 0 && a.failures == 0 {
+			delete(l.entries, k.key)
+		}
+	}
+}
+
+// recent returns the failures that are not older than resetAfter.
+func (a *attempts) recent(now time.Time, resetAfter time.Duration) int {
+	if now.Sub(a.last) > resetAfter {
+		return 0
+	}
+	return a.failures
+}
+
+// userKey and tokenKey keep user and token names apart in the limiter.
+func userKey(name string) string {
+	return "user:" + name
+}
+
+func tokenKey(name string) string {
+	return "token:" + name
+}
+
+func ipKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// sweep drops entries that are neither blocked nor recent, at most once per ResetAfter.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.cfg.ResetAfter {
+		return
+	}
+	l.lastSweep = now
+	for key, a := range l.entries {
+		if a.pending == 0 && now.After(a.until) && now.Sub(a.last) > l.cfg.ResetAfter {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// clientIP returns the IP address of the client that sent r.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fmotalleb/timber/config"
+)
+
+var testLockout = config.Lockout{
+	MaxFailures:   3,
+	MaxIPFailures: 5,
+	BaseDelay:     time.Second,
+	Duration:      time.Minute,
+	ResetAfter:    15 * time.Minute,
+}
+
+func limiterRequest(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ip + ":40000"
+	return r
+}
+
+// blockedFor returns how long key is blocked after its last failure.
+func blockedFor(l *Limiter, key string) time.Duration {
+	a, ok := l.entries[key]
+	if !ok {
+		return 0
+	}
+	return a.until.Sub(a.last)
+}
+
+func TestLimiterBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		user     time.Duration
+		ip       time.Duration
+	}{
+		{1, time.Second, time.Second},
+		{2, 2 * time.Second, 2 * time.Second},
+		// The user is locked out at MaxFailures, the client IP keeps backing off.
+		{3, time.Minute, 4 * time.Second},
+		{4, time.Minute, 8 * time.Second},
+		{5, time.Minute, time.Minute},
+		{6, time.Minute, time.Minute},
+	}
+	l := NewLimiter(testLockout)
+	r := limiterRequest("192.0.2.1")
+	for _, tt := range tests {
+		l.fail(r, userKey("alice"))
+		if got := blockedFor(l, userKey("alice")); got != tt.user {
+			t.Errorf("after %d failures the user is blocked for %v, want %v", tt.failures, got, tt.user)
+		}
+		if got := blockedFor(l, ipKey(r)); got != tt.ip {
+			t.Errorf("after %d failures the client IP is blocked for %v, want %v", tt.failures, got, tt.ip)
+		}
+	}
+}
+
+func TestLimiterBackoffCapped(t *testing.T) {
+	cfg := testLockout
+	cfg.MaxFailures, cfg.MaxIPFailures = 100, 100
+	l := NewLimiter(cfg)
+	r := limiterRequest("192.0.2.1")
+	for range 80 {
+		l.fail(r, userKey("alice"))
+	}
+	if got := blockedFor(l, userKey("alice")); got != cfg.Duration {
+		t.Errorf("backoff = %v, want it capped at %v", got, cfg.Duration)
+	}
+}
+
+func TestLimiterGuard(t *testing.T) {
+	tests := []struct {
+		name     string
+		failUser string
+		failIP   string
+		user     string
+		ip       string
+		want     bool
+	}{
+		{"no failures", "", "", "alice", "192.0.2.1", true},
+		{"user blocked", "alice", "192.0.2.9", "alice", "192.0.2.1", false},
+		{"client IP blocked", "bob", "192.0.2.1", "alice", "192.0.2.1", false},
+		{"other user and IP", "bob", "192.0.2.9", "alice", "192.0.2.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(testLockout)
+			if tt.failUser != "" {
+				l.fail(limiterRequest(tt.failIP), userKey(tt.failUser))
+			}
+			w := httptest.NewRecorder()
+			if got := l.guard(w, limiterRequest(tt.ip), userKey(tt.user)); got != tt.want {
+				t.Fatalf("guard() = %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				return
+			}
+			if w.Code != http.StatusTooManyRequests {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+			}
+			if got := w.Header().Get("Retry-After"); got != "1" {
+				t.Errorf("Retry-After = %q, want %q", got, "1")
+			}
+		})
+	}
+}
+
+func TestLimiterSucceed(t *testing.T) {
+	l := NewLimiter(testLockout)
+	r := limiterRequest("192.0.2.1")
+	l.fail(r, userKey("alice"))
+	l.succeed(r, userKey("alice"))
+	if _, ok := l.entries[userKey("alice")]; ok {
+		t.Error("succeed() kept the failures of the user")
+	}
+	if _, ok := l.entries[ipKey(r)]; !ok {
+		t.Error("succeed() forgot the failures of the client IP")
+	}
+}
+
+func TestLimiterResetAfter(t *testing.T) {
+	l := NewLimiter(testLockout)
+	r := limiterRequest("192.0.2.1")
+	l.fail(r, userKey("alice"))
+	l.fail(r, userKey("alice"))
+	// Pretend the last failure is older than ResetAfter.
+	l.entries[userKey("alice")].last = time.Now().Add(-testLockout.ResetAfter - time.Second)
+	l.fail(r, userKey("alice"))
+	if got := l.entries[userKey("alice")].failures; got != 1 {
+		t.Errorf("failures = %d after ResetAfter, want 1", got)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	cfg := testLockout
+	cfg.MaxFailures = -1
+	l := NewLimiter(cfg)
+	r := limiterRequest("192.0.2.1")
+	for range 10 {
+		l.fail(r, userKey("alice"))
+	}
+	if !l.guard(httptest.NewRecorder(), r, userKey("alice")) {
+		t.Error("guard() blocked with brute-force protection disabled")
+	}
+}
+
+func TestLimiterPending(t *testing.T) {
+	l := NewLimiter(testLockout)
+	r := limiterRequest("192.0.2.1")
+	// Parallel attempts are reserved up to the maximum failures of the user.
+	for i := range testLockout.MaxFailures {
+		if !l.guard(httptest.NewRecorder(), r, userKey("alice")) {
+			t.Fatalf("attempt %d blocked, want it reserved", i+1)
+		}
+	}
+	if l.guard(httptest.NewRecorder(), r, userKey("alice")) {
+		t.Fatal("guard() reserved more attempts than the maximum failures")
+	}
+	if !l.guard(httptest.NewRecorder(), limiterRequest("192.0.2.2"), userKey("bob")) {
+		t.Fatal("guard() blocked another user")
+	}
+	for range testLockout.MaxFailures {
+		l.succeed(r, userKey("alice"))
+	}
+	if a, ok := l.entries[userKey("alice")]; ok {
+		t.Errorf("entry of the user kept after every attempt succeeded: %+v", a)
+	}
+	if !l.guard(httptest.NewRecorder(), r, userKey("alice")) {
+		t.Error("guard() blocked after the pending attempts succeeded")
+	}
+}
+
+func TestLimiterKeys(t *testing.T) {
+	l := NewLimiter(testLockout)
+	for range testLockout.MaxFailures {
+		l.fail(limiterRequest("192.0.2.1"), tokenKey("ci"))
+	}
+	r := limiterRequest("192.0.2.2")
+	if !l.guard(httptest.NewRecorder(), r, userKey("token:ci")) {
+		t.Error("a locked out token blocked the user of the same key")
+	}
+	if l.guard(httptest.NewRecorder(), r, tokenKey("ci")) {
+		t.Error("guard() let a locked out token through")
+	}
+}
+
+func TestLimiterSetConfig(t *testing.T) {
+	l := NewLimiter(testLockout)
+	r := limiterRequest("192.0.2.1")
+	l.fail(r, userKey("alice"))
+	cfg := testLockout
+	cfg.BaseDelay = 2 * time.Second
+	l.SetConfig(cfg)
+	if l.guard(httptest.NewRecorder(), r, userKey("alice")) {
+		t.Error("guard() forgot the failures on SetConfig")
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/config"
+	"github.com/fmotalleb/timber/server/response"
+)
+
+// MethodTrusted is reported in AuthUser.Method for requests on a listener with a trusted user.
+const MethodTrusted = "trusted"
+
+// ErrorUnknownUser is returned when a listener's trusted user is not configured.
+var ErrorUnknownUser = errors.New("unknown user")
+
+// WithTrustedUser is a middleware that authenticates every request as the given
+// user without credentials. It is meant for listeners only trusted clients can reach.
+func WithTrustedUser(cfg config.Config, name string) (func(http.Handler) http.Handler, error) {
+	u, ok := newUserIndex(cfg)[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrorUnknownUser, name)
+	}
+	access := resolveAccess(cfg, u.AccessList)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authUser := &AuthUser{
+				Name:   u.Name,
+				Method: MethodTrusted,
+			}
+			next.ServeHTTP(w, withUser(r, authUser, access))
+		})
+	}, nil
+}
+
+// RestrictMethods is a middleware that rejects users authenticated by a method
+// not in methods. Trusted users are always accepted, and no methods accept all.
+func RestrictMethods(methods []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if len(methods) == 0 || (ok && (user.Method == MethodTrusted || slices.Contains(methods, user.Method))) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			log.Of(r.Context()).Warn("authentication method not allowed on listener", zap.Any("user", user))
+			response.Unauthorized(w)
+		})
+	}
+}
@@ -1,59 +1,102 @@
 package auth
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/fmotalleb/go-tools/log"
 
 	"github.com/fmotalleb/timber/config"
+	"github.com/fmotalleb/timber/server/auth/passwd"
 	"github.com/fmotalleb/timber/server/response"
 )
 
 // WithBasicAuth is a middleware that provides basic authentication.
-func WithBasicAuth(cfg config.Config) func(http.Handler) http.Handler {
-	// build user index once
-	users := make(map[string]config.User, len(cfg.Users))
-	for _, u := range cfg.Users {
-		users[u.Name] = u
-	}
+// A valid session cookie is accepted as an alternative credential, and requests
+// already authenticated by a preceding authenticator are passed through.
+// Failed attempts are throttled by the limiter.
+func WithBasicAuth(cfg config.Config, sessions *Sessions, limiter *Limiter) func(http.Handler) http.Handler {
+	users := newUserIndex(cfg)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := UserFromContext(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
 			logger := log.Of(r.Context())
 			username, password, ok := r.BasicAuth()
 			if !ok {
+				if sr, authenticated := sessions.authenticate(w, r, cfg, users); authenticated {
+					next.ServeHTTP(w, sr)
+					return
+				}
 				logger.Warn("no auth found")
 				response.Unauthorized(w)
 				return
 			}
 
-			u, ok := users[username]
-			if !ok || u.Password != password {
+			if !limiter.guard(w, r, userKey(username)) {
+				return
+			}
+			u, ok := users.verify(username, password)
+			if !ok {
 				logger.Warn("authentication failed")
+				limiter.fail(r, userKey(username))
 				response.Unauthorized(w)
 				return
 			}
-
-			// resolve access lists
-			var access []string
-			for _, name := range u.AccessList {
-				a, ok := cfg.Access[name]
-				if !ok {
-					continue
-				}
-				access = append(access, a.Paths...)
-			}
+			limiter.succeed(r, userKey(username))
 
 			authUser := &AuthUser{
 				Name:   u.Name,
-				Access: access,
+				Method: MethodBasic,
 			}
+			next.ServeHTTP(w, withUser(r, authUser, resolveAccess(cfg, u.AccessList)))
+		})
+	}
+}
 
-			ctx := context.WithValue(r.Context(), ctxUserKey, authUser)
-			ctx = context.WithValue(ctx, ctxAccessKey, access)
+// userIndex maps user names to configured users.
+type userIndex map[string]config.User
+
+func newUserIndex(cfg config.Config) userIndex {
+	users := make(userIndex, len(cfg.Users))
+	for _, u := range cfg.Users {
+		users[u.Name] = u
+	}
+	return users
+}
+
+// verify returns the user if the password matches.
+func (idx userIndex) verify(username, password string) (config.User, bool) {
+	u, ok := idx[username]
+	if !ok || !passwd.Verify(u.Password, password) {
+		return config.User{}, false
+	}
+	return u, true
+}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
+// resolveAccess builds the access rules of the given access group names.
+func resolveAccess(cfg config.Config, accessList []string) Rules {
+	var access Rules
+	for _, name := range accessList {
+		a, ok := cfg.Access[name]
+		if !ok {
+			continue
+		}
+		allow, deny := a.Patterns()
+		ops := make([]Op, 0, len(a.Ops))
+		for _, op := range a.Ops {
+			ops = append(ops, Op(op))
+		}
+		access.Grants = append(access.Grants, Grant{
+			Patterns:       allow,
+			Deny:           deny,
+			Ops:            ops,
+			FollowSymlinks: a.FollowSymlinks,
+			Parser:         a.Parser,
+			Pattern:        a.Pattern,
 		})
 	}
+	return access
 }
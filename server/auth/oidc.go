@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+
+	"github.com/fmotalleb/timber/config"
+)
+
+const (
+	// MethodOIDC is reported in AuthUser.Method for OpenID Connect sessions.
+	MethodOIDC = "oidc"
+
+	oidcStateCookie   = "timber_oidc"
+	oidcStateLifetime = 10 * time.Minute
+	oidcCallbackPath  = "/auth/oidc/callback"
+	oidcRandomLen     = 32
+)
+
+// oidcState is kept in a short-lived signed cookie between login and callback.
+type oidcState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Expires  int64  `json:"e"`
+}
+
+// OIDC handles OpenID Connect authorization-code logins.
+type OIDC struct {
+	cfg      config.OIDC
+	ctx      context.Context
+	sessions *Sessions
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDC creates the OIDC login handlers.
+// The provider is discovered lazily on the first login, so a down issuer does not prevent startup.
+func NewOIDC(ctx context.Context, cfg config.OIDC, sessions *Sessions) *OIDC {
+	return &OIDC{
+		cfg:      cfg,
+		ctx:      ctx,
+		sessions: sessions,
+	}
+}
+
+func (o *OIDC) getProvider() (*oidc.Provider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider != nil {
+		return o.provider, nil
+	}
+	p, err := oidc.NewProvider(o.ctx, o.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover oidc provider: %w", err)
+	}
+	o.provider = p
+	return p, nil
+}
+
+func (o *OIDC) oauth2Config(r *http.Request, p *oidc.Provider) *oauth2.Config {
+	redirect := o.cfg.RedirectURL
+	if redirect == "" {
+		scheme := "http"
+		if isSecure(r) {
+			scheme = "https"
+		}
+		redirect = scheme + "://" + r.Host + o.sessions.basePath + oidcCallbackPath
+	}
+	scopes := []string{oidc.ScopeOpenID, "profile", "email"}
+	for _, s := range o.cfg.Scopes {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return &oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		Endpoint:     p.Endpoint(),
+		RedirectURL:  redirect,
+		Scopes:       scopes,
+	}
+}
+
+// Login redirects the browser to the provider.
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	logger := log.Of(r.Context())
+	p, err := o.getProvider()
+	if err != nil {
+		logger.Error("oidc provider unavailable", zap.Error(err))
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	st := oidcState{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: oauth2.GenerateVerifier(),
+		Expires:  time.Now().Add(oidcStateLifetime).Unix(),
+	}
+	value, err := o.sessions.sign(st)
+	if err != nil {
+		logger.Error("failed to sign oidc state", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	o.sessions.setCookie(w, r, oidcStateCookie, value, time.Unix(st.Expires, 0))
+
+	url := o.oauth2Config(r, p).AuthCodeURL(
+		st.State,
+		oidc.Nonce(st.Nonce),
+		oauth2.S256ChallengeOption(st.Verifier),
+	)
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// Callback completes the login, issues the session cookie and redirects to the UI.
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	logger := log.Of(r.Context())
+	name, access, err := o.exchange(r)
+	o.sessions.setCookie(w, r, oidcStateCookie, "", time.Unix(0, 0))
+	if err != nil {
+		logger.Warn("oidc login failed", zap.Error(err))
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+	if err := o.sessions.Issue(w, r, name, MethodOIDC, access); err != nil {
+		logger.Error("failed to issue session", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("oidc login", zap.String("user", name), zap.Strings("access", access))
+	http.Redirect(w, r, o.sessions.basePath+"/", http.StatusFound)
+}
+
+// exchange validates the callback and returns the user name and access groups.
+func (o *OIDC) exchange(r *http.Request) (string, []string, error) {
+	var st oidcState
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return "", nil, fmt.Errorf("missing state cookie: %w", err)
+	}
+	if err = o.sessions.verify(c.Value, &st); err != nil || time.Now().Unix() > st.Expires {
+		return "", nil, errors.New("invalid state cookie")
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return "", nil, fmt.Errorf("provider error: %s: %s", e, q.Get("error_description"))
+	}
+	if q.Get("state") != st.State {
+		return "", nil, errors.New("state mismatch")
+	}
+
+	p, err := o.getProvider()
+	if err != nil {
+		return "", nil, err
+	}
+	tok, err := o.oauth2Config(r, p).Exchange(r.Context(), q.Get("code"), oauth2.VerifierOption(st.Verifier))
+	if err != nil {
+		return "", nil, fmt.Errorf("exchange code: %w", err)
+	}
+	rawID, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return "", nil, errors.New("no id_token in token response")
+	}
+	idToken, err := p.Verifier(&oidc.Config{ClientID: o.cfg.ClientID}).Verify(r.Context(), rawID)
+	if err != nil {
+		return "", nil, fmt.Errorf("verify id_token: %w", err)
+	}
+	if idToken.Nonce != st.Nonce {
+		return "", nil, errors.New("nonce mismatch")
+	}
+	claims := make(map[string]any)
+	if err := idToken.Claims(&claims); err != nil {
+		return "", nil, fmt.Errorf("decode claims: %w", err)
+	}
+
+	name := idToken.Subject
+	for _, key := range []string{o.cfg.UsernameClaim, "email"} {
+		if v, ok := claims[key].(string); ok && v != "" {
+			name = v
+			break
+		}
+	}
+	return name, o.mapGroups(claims[o.cfg.GroupsClaim]), nil
+}
+
+// mapGroups maps the groups claim to timber access groups.
+// Config keys are case-insensitive, so claim values are compared in lower case.
+func (o *OIDC) mapGroups(claim any) []string {
+	var groups []string
+	switch v := claim.(type) {
+	case string:
+		groups = []string{v}
+	case []any:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+
+	mapping := make(map[string][]string, len(o.cfg.Groups))
+	for k, v := range o.cfg.Groups {
+		mapping[strings.ToLower(k)] = v
+	}
+	access := slices.Clone(o.cfg.Access)
+	for _, g := range groups {
+		for _, a := range mapping[strings.ToLower(g)] {
+			if !slices.Contains(access, a) {
+				access = append(access, a)
+			}
+		}
+	}
+	return access
+}
+
+func randomString() string {
+	b := make([]byte, oidcRandomLen)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/fmotalleb/timber/server/helper"
+)
+
+// Op is an operation a user can perform on a path.
+type Op string
+
+// Operations that can be granted by an access group.
+const (
+	OpLs       Op = "ls"
+	OpCat      Op = "cat"
+	OpHead     Op = "head"
+	OpTail     Op = "tail"
+	OpFollow   Op = "follow"
+	OpDownload Op = "download"
+	OpRange    Op = "range"
+	OpGrep     Op = "grep"
+	OpParse    Op = "parse"
+)
+
+// AllOps lists every known operation.
+var AllOps = []Op{OpLs, OpCat, OpHead, OpTail, OpFollow, OpDownload, OpRange, OpGrep, OpParse}
+
+// ErrorUnknownOp is returned for an operation that is not in AllOps.
+var ErrorUnknownOp = errors.New("unknown operation")
+
+// ValidateOps checks that every operation name is known.
+func ValidateOps(names []string) error {
+	for _, name := range names {
+		if !slices.Contains(AllOps, Op(name)) {
+			return fmt.Errorf("%w: %q", ErrorUnknownOp, name)
+		}
+	}
+	return nil
+}
+
+// OpResolver returns the operation performed by a request.
+type OpResolver func(r *http.Request) Op
+
+// Static resolves every request to op.
+func Static(op Op) OpResolver {
+	return func(_ *http.Request) Op {
+		return op
+	}
+}
+
+// WithFlag resolves to flagOp when the boolean query parameter flag is set, otherwise to op.
+func WithFlag(op Op, flag string, flagOp Op) OpResolver {
+	return func(r *http.Request) Op {
+		if helper.GetFlag(r, flag) {
+			return flagOp
+		}
+		return op
+	}
+}
+
+// permits reports whether the grant allows op.
+// A grant without ops allows everything, and listing is implied by any other op.
+func (g Grant) permits(op Op) bool {
+	if len(g.Ops) == 0 || op == OpLs {
+		return true
+	}
+	return slices.Contains(g.Ops, op)
+}
@@ -0,0 +1,15 @@
+package passwd
+
+import "golang.org/x/crypto/bcrypt"
+
+func hashBcrypt(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+func verifyBcrypt(stored, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+}
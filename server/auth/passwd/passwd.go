@@ -0,0 +1,69 @@
+// Package passwd provides password hashing and verification for configured credentials.
+package passwd
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+// Algorithm names a supported password hashing scheme.
+type Algorithm string
+
+const (
+	// Plain is a non-hashed password, compared in constant time.
+	Plain Algorithm = "plain"
+	// Bcrypt is the bcrypt scheme ($2a$, $2b$, $2y$).
+	Bcrypt Algorithm = "bcrypt"
+	// Argon2id is the argon2id scheme in PHC string format ($argon2id$).
+	Argon2id Algorithm = "argon2id"
+	// SHA512Crypt is the glibc SHA-512 crypt scheme ($6$).
+	SHA512Crypt Algorithm = "sha512-crypt"
+)
+
+// ErrUnsupportedAlgorithm is returned when hashing with an unknown algorithm.
+var ErrUnsupportedAlgorithm = errors.New("unsupported password hashing algorithm")
+
+// Detect returns the algorithm used by the given stored password based on its prefix.
+func Detect(stored string) Algorithm {
+	switch {
+	case strings.HasPrefix(stored, "$2a$"),
+		strings.HasPrefix(stored, "$2b$"),
+		strings.HasPrefix(stored, "$2y$"):
+		return Bcrypt
+	case strings.HasPrefix(stored, argon2idPrefix):
+		return Argon2id
+	case strings.HasPrefix(stored, sha512CryptPrefix):
+		return SHA512Crypt
+	default:
+		return Plain
+	}
+}
+
+// Verify reports whether password matches the stored (hashed or plaintext) value.
+func Verify(stored, password string) bool {
+	switch Detect(stored) {
+	case Bcrypt:
+		return verifyBcrypt(stored, password)
+	case Argon2id:
+		return verifyArgon2id(stored, password)
+	case SHA512Crypt:
+		return verifySHA512Crypt(stored, password)
+	default:
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	}
+}
+
+// Hash hashes the password using the given algorithm.
+func Hash(algo Algorithm, password string) (string, error) {
+	switch algo {
+	case Bcrypt:
+		return hashBcrypt(password)
+	case Argon2id:
+		return hashArgon2id(password)
+	case SHA512Crypt:
+		return hashSHA512Crypt(password)
+	default:
+		return "", ErrUnsupportedAlgorithm
+	}
+}
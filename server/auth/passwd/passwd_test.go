@@ -0,0 +1,173 @@
+package passwd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		stored string
+		want   Algorithm
+	}{
+		{"secret", Plain},
+		{"", Plain},
+		{"$2a$10$abcdefghijklmnopqrstuu", Bcrypt},
+		{"$2b$10$abcdefghijklmnopqrstuu", Bcrypt},
+		{"$2y$10$abcdefghijklmnopqrstuu", Bcrypt},
+		{"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA", Argon2id},
+		{"$argon2i$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA", Plain},
+		{"$6$salt$hash", SHA512Crypt},
+		{"$5$salt$hash", Plain},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.stored); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.stored, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		want     bool
+	}{
+		{"plain match", "secret", "secret", true},
+		{"plain mismatch", "secret", "Secret", false},
+		{"plain empty", "", "", true},
+		{
+			"bcrypt match",
+			"$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW",
+			"U*U", true,
+		},
+		{
+			"bcrypt mismatch",
+			"$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW",
+			"U*V", false,
+		},
+		{
+			"argon2id match",
+			"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+			"password", true,
+		},
+		{
+			"argon2id mismatch",
+			"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+			"passwore", false,
+		},
+		{"argon2id wrong version", "$argon2id$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", "password", false},
+		{"argon2id malformed", "$argon2id$v=19$c29tZXNhbHQ", "password", false},
+		{"sha512-crypt mismatch", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world", false},
+		{"sha512-crypt without hash", "$6$saltstring", "Hello world!", false},
+		{"sha512-crypt bad rounds", "$6$rounds=ten$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl", "Hello world!", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.stored, tt.password); got != tt.want {
+				t.Errorf("Verify(%q, %q) = %v, want %v", tt.stored, tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+// The test vectors of https://www.akkadia.org/drepper/SHA-crypt.txt.
+var sha512CryptVectors = []struct {
+	password string
+	stored   string
+}{
+	{
+		"Hello world!",
+		"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+	},
+	{
+		"Hello world!",
+		"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+	},
+	{
+		"This is just a test",
+		"$6$rounds=5000$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0",
+	},
+	{
+		"a very much longer text to encrypt.  This one even stretches over morethan one line.",
+		"$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1",
+	},
+	{
+		"we have a short salt string but not a short password",
+		"$6$rounds=77777$short$WuQyW2YR.hBNpjjRhpYD/ifIw05xdfeEyQoMxIXbkvr0gge1a1x3yRULJ5CCaUeOxFmtlcGZelFl5CxtgfiAc0",
+	},
+	{
+		"a short string",
+		"$6$rounds=123456$asaltof16chars..$BtCwjqMJGx5hrJhZywWvt0RLE8uZ4oPwcelCjmw2kSYu.Ec6ycULevoBK25fs2xXgMNrCzIMVcgEJAstJeonj1",
+	},
+	{
+		"the minimum number is still observed",
+		"$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.",
+	},
+}
+
+func TestSHA512CryptVectors(t *testing.T) {
+	for _, tt := range sha512CryptVectors {
+		t.Run(tt.password, func(t *testing.T) {
+			if !Verify(tt.stored, tt.password) {
+				t.Errorf("Verify(%q, %q) = false, want true", tt.stored, tt.password)
+			}
+		})
+	}
+}
+
+func TestSHA512Crypt(t *testing.T) {
+	tests := []struct {
+		password     string
+		salt         string
+		rounds       int
+		customRounds bool
+		want         string
+	}{
+		{"Hello world!", "saltstring", sha512CryptDefaultRounds, false, sha512CryptVectors[0].stored},
+		{"Hello world!", "saltstringsaltst", 10000, true, sha512CryptVectors[1].stored},
+		{"the minimum number is still observed", "roundstoolow", sha512CryptMinRounds, true, sha512CryptVectors[6].stored},
+	}
+	for _, tt := range tests {
+		if got := sha512Crypt([]byte(tt.password), []byte(tt.salt), tt.rounds, tt.customRounds); got != tt.want {
+			t.Errorf("sha512Crypt(%q, %q, %d) = %q, want %q", tt.password, tt.salt, tt.rounds, got, tt.want)
+		}
+	}
+}
+
+func TestSHA512CryptClampsRounds(t *testing.T) {
+	// Rounds below the minimum are raised to it; the stored value keeps the requested count.
+	stored := "$6$rounds=10$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX."
+	if !Verify(stored, "the minimum number is still observed") {
+		t.Errorf("Verify(%q) = false, want true", stored)
+	}
+}
+
+func TestHash(t *testing.T) {
+	for _, algo := range []Algorithm{Bcrypt, Argon2id, SHA512Crypt} {
+		t.Run(string(algo), func(t *testing.T) {
+			stored, err := Hash(algo, "s3cret")
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+			if got := Detect(stored); got != algo {
+				t.Errorf("Detect(Hash()) = %q, want %q", got, algo)
+			}
+			if !Verify(stored, "s3cret") {
+				t.Error("Verify() of the hashed password = false, want true")
+			}
+			if Verify(stored, "s3cret!") {
+				t.Error("Verify() of another password = true, want false")
+			}
+		})
+	}
+}
+
+func TestHashUnsupported(t *testing.T) {
+	for _, algo := range []Algorithm{Plain, "md5"} {
+		if _, err := Hash(algo, "s3cret"); !errors.Is(err, ErrUnsupportedAlgorithm) {
+			t.Errorf("Hash(%q) error = %v, want %v", algo, err, ErrUnsupportedAlgorithm)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package passwd
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"strconv"
+	"strings"
+)
+
+// SHA-512 crypt as specified in https://www.akkadia.org/drepper/SHA-crypt.txt.
+
+const (
+	sha512CryptPrefix        = "$6$"
+	sha512CryptRoundsPrefix  = "rounds="
+	sha512CryptDefaultRounds = 5000
+	sha512CryptMinRounds     = 1000
+	sha512CryptMaxRounds     = 999999999
+	sha512CryptSaltLen       = 16
+	sha512CryptSaltRepeat    = 16
+
+	cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	cryptCharBits = 6
+	cryptCharMask = 1<<cryptCharBits - 1
+)
+
+// sha512CryptPermutation is the byte order used when encoding the final digest.
+var sha512CryptPermutation = [...][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+	{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+	{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+	{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+	{62, 20, 41},
+}
+
+func hashSHA512Crypt(password string) (string, error) {
+	raw := make([]byte, sha512CryptSaltLen)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	salt := make([]byte, sha512CryptSaltLen)
+	for i, b := range raw {
+		salt[i] = cryptAlphabet[int(b)%len(cryptAlphabet)]
+	}
+	return sha512Crypt([]byte(password), salt, sha512CryptDefaultRounds, false), nil
+}
+
+func verifySHA512Crypt(stored, password string) bool {
+	rest := strings.TrimPrefix(stored, sha512CryptPrefix)
+	rounds := sha512CryptDefaultRounds
+	customRounds := false
+	if strings.HasPrefix(rest, sha512CryptRoundsPrefix) {
+		end := strings.IndexByte(rest, '$')
+		if end == -1 {
+			return false
+		}
+		n, err := strconv.Atoi(rest[len(sha512CryptRoundsPrefix):end])
+		if err != nil {
+			return false
+		}
+		rounds = min(max(n, sha512CryptMinRounds), sha512CryptMaxRounds)
+		customRounds = true
+		rest = rest[end+1:]
+	}
+	end := strings.IndexByte(rest, '$')
+	if end == -1 {
+		return false
+	}
+	salt := rest[:min(end, sha512CryptSaltLen)]
+
+	// Compare digests only; the encoded rounds may have been clamped.
+	want := rest[end+1:]
+	got := sha512Crypt([]byte(password), []byte(salt), rounds, customRounds)
+	got = got[strings.LastIndexByte(got, '$')+1:]
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func sha512Crypt(password, salt []byte, rounds int, customRounds bool) string {
+	pLen := len(password)
+
+	alt := sha512.New()
+	alt.Write(password)
+	alt.Write(salt)
+	alt.Write(password)
+	altSum := alt.Sum(nil)
+
+	a := sha512.New()
+	a.Write(password)
+	a.Write(salt)
+	for n := pLen; n > 0; n -= sha512.Size {
+		a.Write(altSum[:min(n, sha512.Size)])
+	}
+	for n := pLen; n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(altSum)
+		} else {
+			a.Write(password)
+		}
+	}
+	sum := a.Sum(nil)
+
+	dp := sha512.New()
+	for range pLen {
+		dp.Write(password)
+	}
+	pSeq := repeatTo(dp.Sum(nil), pLen)
+
+	ds := sha512.New()
+	for range sha512CryptSaltRepeat + int(sum[0]) {
+		ds.Write(salt)
+	}
+	sSeq := repeatTo(ds.Sum(nil), len(salt))
+
+	for i := range rounds {
+		c := sha512.New()
+		if i&1 != 0 {
+			c.Write(pSeq)
+		} else {
+			c.Write(sum)
+		}
+		if i%3 != 0 {
+			c.Write(sSeq)
+		}
+		if i%7 != 0 {
+			c.Write(pSeq)
+		}
+		if i&1 != 0 {
+			c.Write(sum)
+		} else {
+			c.Write(pSeq)
+		}
+		sum = c.Sum(sum[:0])
+	}
+
+	var b strings.Builder
+	b.WriteString(sha512CryptPrefix)
+	if customRounds {
+		b.WriteString(sha512CryptRoundsPrefix)
+		b.WriteString(strconv.Itoa(rounds))
+		b.WriteByte('$')
+	}
+	b.Write(salt)
+	b.WriteByte('$')
+	for _, p := range sha512CryptPermutation {
+		encode24(&b, sum[p[0]], sum[p[1]], sum[p[2]], 4)
+	}
+	encode24(&b, 0, 0, sum[sha512.Size-1], 2)
+	return b.String()
+}
+
+func encode24(b *strings.Builder, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for range n {
+		b.WriteByte(cryptAlphabet[w&cryptCharMask])
+		w >>= cryptCharBits
+	}
+}
+
+func repeatTo(src []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, src[:min(len(src), n-len(out))]...)
+	}
+	return out
+}
@@ -1,10 +1,13 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"path"
+	"path/filepath"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/fmotalleb/go-tools/log"
 	"go.uber.org/zap"
 
@@ -15,38 +18,65 @@ import (
 // ErrorPermissionDeny is returned when a user does not have permission to access a resource.
 var ErrorPermissionDeny = errors.New("permission denied")
 
-// PermissionCheck is a middleware that checks if a user has permission to access a resource.
-func PermissionCheck(next http.Handler) http.Handler {
-	return http.HandlerFunc(
-		func(w http.ResponseWriter, r *http.Request) {
-			if err := permissionHandler(w, r); err != nil {
-				return
-			}
-			next.ServeHTTP(w, r)
-		},
-	)
+// PermissionCheck returns a middleware that checks if a user may perform the
+// operation resolved by op on the requested resource.
+// The requested path is resolved once and handed to the next handler through helper.GetPath.
+func PermissionCheck(op OpResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				r, err := permissionHandler(w, r, op(r))
+				if err != nil {
+					return
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
 }
 
-func permissionHandler(w http.ResponseWriter, r *http.Request) error {
-	logger := log.Of(r.Context())
+func permissionHandler(w http.ResponseWriter, r *http.Request, op Op) (*http.Request, error) {
 	reqPath, ok := helper.GetPath(r)
 	if !ok {
-		return nil
+		return r, nil
 	}
-	access, ok := AccessFromContext(r.Context())
+	resolved, err := Authorize(r.Context(), reqPath, op)
+	switch {
+	case err == nil:
+		return helper.WithPath(r, resolved), nil
+	case errors.Is(err, ErrorInvalidPath):
+		http.Error(w, "invalid path", http.StatusBadRequest)
+	default:
+		response.PermissionDenied(w)
+	}
+	return nil, err
+}
+
+// Authorize checks that the user in ctx may perform op on name, as PermissionCheck
+// does for the requested path, and returns the path that should be opened.
+func Authorize(ctx context.Context, name string, op Op) (string, error) {
+	logger := log.Of(ctx)
+	access, ok := AccessFromContext(ctx)
 	if !ok {
 		logger.Warn("user not found in the request context")
-		response.PermissionDenied(w)
-		return ErrorPermissionDeny
+		return "", ErrorPermissionDeny
 	}
-	for _, acc := range access {
-		if matched, err := path.Match(acc, reqPath); err == nil && matched {
-			return nil
-		} else if err != nil {
-			logger.Warn("path match evaluation failed", zap.Error(err))
-		}
+	resolved, err := access.Resolve(name, op)
+	switch {
+	case err == nil, errors.Is(err, ErrorInvalidPath):
+	case errors.Is(err, ErrorPermissionDeny):
+		logger.Debug("access to path denied", zap.String("path", name), zap.String("op", string(op)))
+	default:
+		logger.Warn("failed to resolve path", zap.String("path", name), zap.Error(err))
 	}
+	return resolved, err
+}
 
-	response.PermissionDenied(w)
-	return ErrorPermissionDeny
+// MatchPath reports whether name matches the access pattern.
+// Patterns support `**` to match any number of nested directories.
+func MatchPath(pattern, name string) (bool, error) {
+	return doublestar.Match(
+		path.Clean(filepath.ToSlash(pattern)),
+		path.Clean(filepath.ToSlash(name)),
+	)
 }
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+var (
+	// ErrorInvalidPath is returned when a requested path is malformed.
+	ErrorInvalidPath = errors.New("invalid path")
+	// ErrorInvalidPattern is returned for a malformed allow or deny pattern.
+	ErrorInvalidPattern = errors.New("invalid path pattern")
+)
+
+// Grant is the set of allow and deny patterns and operations of a single
+// access group, and the parser of its files. Deny patterns only exclude paths
+// from the patterns of their own grant.
+type Grant struct {
+	Patterns       []string
+	Deny           []string
+	Ops            []Op
+	FollowSymlinks bool
+	Parser         string
+	Pattern        string
+}
+
+// Rules holds the resolved grants of a user.
+type Rules struct {
+	Grants []Grant
+}
+
+// Allow returns the allow patterns of all grants.
+func (r Rules) Allow() []string {
+	var allow []string
+	for _, g := range r.Grants {
+		allow = append(allow, g.Patterns...)
+	}
+	return allow
+}
+
+// Deny returns the deny patterns of all grants.
+func (r Rules) Deny() []string {
+	var deny []string
+	for _, g := range r.Grants {
+		deny = append(deny, g.Deny...)
+	}
+	return deny
+}
+
+// Allowed reports whether op may be performed on name.
+func (r Rules) Allowed(name string, op Op) bool {
+	return len(r.matching(name, op)) != 0
+}
+
+// denied reports whether name, or any of its parent directories, matches a deny pattern of g.
+// Deny patterns without a `/` are matched against base names, so `*.key` denies keys anywhere.
+func (g Grant) denied(name string) bool {
+	if len(g.Deny) == 0 {
+		return false
+	}
+	for p := path.Clean(filepath.ToSlash(name)); ; p = path.Dir(p) {
+		for _, pat := range g.Deny {
+			target := p
+			if !strings.Contains(pat, "/") {
+				target = path.Base(p)
+			}
+			if matched, err := MatchPath(pat, target); err == nil && matched {
+				return true
+			}
+		}
+		if parent := path.Dir(p); parent == p {
+			return false
+		}
+	}
+}
+
+// Resolve canonicalizes name and checks both the requested path and, if it
+// goes through a symlink, its real target against the rules for op.
+// Symlinks are only followed when a grant matching name opts in.
+// It returns the path that should be opened.
+func (r Rules) Resolve(name string, op Op) (string, error) {
+	if containsDotDot(name) {
+		return "", ErrorInvalidPath
+	}
+	clean := filepath.Clean(name)
+	grants := r.matching(clean, op)
+	if len(grants) == 0 {
+		return "", ErrorPermissionDeny
+	}
+
+	real, err := filepath.EvalSymlinks(clean)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return clean, nil
+		}
+		return "", err
+	}
+	if real == clean {
+		return clean, nil
+	}
+
+	follow := false
+	for _, g := range grants {
+		follow = follow || g.FollowSymlinks
+	}
+	if !follow || !r.Allowed(real, op) {
+		return "", ErrorPermissionDeny
+	}
+	return real, nil
+}
+
+// Ops returns the operations allowed on name, in AllOps order, and the path to
+// open for them. It checks the rules as Resolve does for each operation, but
+// resolves symlinks and matches the patterns only once.
+func (r Rules) Ops(name string) (string, []Op, error) {
+	if containsDotDot(name) {
+		return "", nil, ErrorInvalidPath
+	}
+	clean := filepath.Clean(name)
+	grants := r.matching(clean, "")
+	if len(grants) == 0 {
+		return "", nil, ErrorPermissionDeny
+	}
+
+	real, err := filepath.EvalSymlinks(clean)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		real = clean
+	case err != nil:
+		return "", nil, err
+	}
+	var realGrants []Grant
+	if real != clean {
+		realGrants = r.matching(real, "")
+	}
+
+	var ops []Op
+	for _, op := range AllOps {
+		allowed := slices.ContainsFunc(grants, func(g Grant) bool {
+			return g.permits(op) && (real == clean || g.FollowSymlinks)
+		})
+		if allowed && real != clean {
+			allowed = slices.ContainsFunc(realGrants, func(g Grant) bool { return g.permits(op) })
+		}
+		if allowed {
+			ops = append(ops, op)
+		}
+	}
+	if len(ops) == 0 {
+		return "", nil, ErrorPermissionDeny
+	}
+	return real, ops, nil
+}
+
+// Parser returns the parser name and pattern of the first grant that allows op
+// on name and sets a parser, or empty strings when none does.
+func (r Rules) Parser(name string, op Op) (string, string) {
+	for _, g := range r.matching(filepath.Clean(name), op) {
+		if g.Parser != "" {
+			return g.Parser, g.Pattern
+		}
+	}
+	return "", ""
+}
+
+// matching returns the grants that allow op on name, or that match name
+// whatever their operations when op is empty.
+func (r Rules) matching(name string, op Op) []Grant {
+	var grants []Grant
+	for _, g := range r.Grants {
+		if (op != "" && !g.permits(op)) || g.denied(name) {
+			continue
+		}
+		for _, pat := range g.Patterns {
+			if matched, err := MatchPath(pat, name); err == nil && matched {
+				grants = append(grants, g)
+				break
+			}
+		}
+	}
+	return grants
+}
+
+// ValidatePatterns checks that the allow and deny patterns of an access group
+// are well formed, as malformed patterns would never match.
+func ValidatePatterns(patterns ...string) error {
+	for _, p := range patterns {
+		if !doublestar.ValidatePattern(path.Clean(filepath.ToSlash(p))) {
+			return fmt.Errorf("%w: %q", ErrorInvalidPattern, p)
+		}
+	}
+	return nil
+}
+
+func containsDotDot(v string) bool {
+	if !strings.Contains(v, "..") {
+		return false
+	}
+	for _, ent := range strings.Split(v, "/") {
+		if ent == ".." {
+			return true
+		}
+	}
+	for _, ent := range strings.Split(v, `\`) {
+		if ent == ".." {
+			return true
+		}
+	}
+	return false
+}
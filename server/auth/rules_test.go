@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// ruleTree creates logs/app.log, logs/app.key, other/real.log and secret/key
+// under a temporary directory, with logs/other.log linking to other/real.log
+// and logs/secret.log linking to secret/key, and returns the directory.
+func ruleTree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"logs/app.log", "logs/app.key", "other/real.log", "secret/key"} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("line\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{"logs/other.log": "other/real.log", "logs/secret.log": "secret/key"}
+	for link, target := range links {
+		if err := os.Symlink(filepath.Join(dir, target), filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRulesResolve(t *testing.T) {
+	dir := ruleTree(t)
+	logs := Grant{Patterns: []string{dir + "/logs/**"}}
+	logsDeny := func(deny string) Grant {
+		return Grant{Patterns: logs.Patterns, Deny: []string{deny}}
+	}
+	tests := []struct {
+		name    string
+		rules   Rules
+		path    string
+		op      Op
+		want    string
+		wantErr error
+	}{
+		{"allowed", Rules{Grants: []Grant{logs}}, "logs/app.log", OpCat, "logs/app.log", nil},
+		{"not granted", Rules{Grants: []Grant{logs}}, "other/real.log", OpCat, "", ErrorPermissionDeny},
+		{"dot dot", Rules{Grants: []Grant{logs}}, "logs/../secret/key", OpCat, "", ErrorInvalidPath},
+		{"missing file", Rules{Grants: []Grant{logs}}, "logs/gone.log", OpCat, "logs/gone.log", nil},
+		{"denied base name", Rules{Grants: []Grant{logsDeny("*.key")}}, "logs/app.key", OpCat, "", ErrorPermissionDeny},
+		{"denied parent", Rules{Grants: []Grant{logsDeny(dir + "/logs")}}, "logs/app.log", OpCat, "", ErrorPermissionDeny},
+		{"deny does not match", Rules{Grants: []Grant{logsDeny("*.key")}}, "logs/app.log", OpCat, "logs/app.log", nil},
+		{
+			"deny of another grant",
+			Rules{Grants: []Grant{logsDeny("*.key"), {Patterns: []string{dir + "/logs/*.key"}}}},
+			"logs/app.key", OpCat, "logs/app.key", nil,
+		},
+		{
+			"op granted",
+			Rules{Grants: []Grant{{Patterns: logs.Patterns, Ops: []Op{OpTail}}}},
+			"logs/app.log", OpTail, "logs/app.log", nil,
+		},
+		{
+			"op not granted",
+			Rules{Grants: []Grant{{Patterns: logs.Patterns, Ops: []Op{OpTail}}}},
+			"logs/app.log", OpDownload, "", ErrorPermissionDeny,
+		},
+		{
+			"ls implied",
+			Rules{Grants: []Grant{{Patterns: logs.Patterns, Ops: []Op{OpTail}}}},
+			"logs/app.log", OpLs, "logs/app.log", nil,
+		},
+		{
+			"op of another grant",
+			Rules{Grants: []Grant{
+				{Patterns: logs.Patterns, Ops: []Op{OpTail}},
+				{Patterns: []string{dir + "/logs/*.log"}, Ops: []Op{OpDownload}},
+			}},
+			"logs/app.log", OpDownload, "logs/app.log", nil,
+		},
+		{"symlink not followed", Rules{Grants: []Grant{logs}}, "logs/other.log", OpCat, "", ErrorPermissionDeny},
+		{
+			"symlink target not granted",
+			Rules{Grants: []Grant{{Patterns: logs.Patterns, FollowSymlinks: true}}},
+			"logs/other.log", OpCat, "", ErrorPermissionDeny,
+		},
+		{
+			"symlink followed",
+			Rules{Grants: []Grant{
+				{Patterns: logs.Patterns, FollowSymlinks: true},
+				{Patterns: []string{dir + "/other/*"}},
+			}},
+			"logs/other.log", OpCat, "other/real.log", nil,
+		},
+		{
+			"symlink target op not granted",
+			Rules{Grants: []Grant{
+				{Patterns: logs.Patterns, FollowSymlinks: true},
+				{Patterns: []string{dir + "/other/*"}, Ops: []Op{OpHead}},
+			}},
+			"logs/other.log", OpCat, "", ErrorPermissionDeny,
+		},
+		{
+			"symlink target denied",
+			Rules{Grants: []Grant{{Patterns: []string{dir + "/**"}, Deny: []string{dir + "/secret"}, FollowSymlinks: true}}},
+			"logs/secret.log", OpCat, "", ErrorPermissionDeny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.Resolve(dir+"/"+tt.path, tt.op)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got != filepath.Join(dir, tt.want) {
+				t.Errorf("Resolve() = %q, want %q", got, filepath.Join(dir, tt.want))
+			}
+		})
+	}
+}
+
+func TestRulesOps(t *testing.T) {
+	dir := ruleTree(t)
+	tests := []struct {
+		name    string
+		rules   Rules
+		path    string
+		want    []Op
+		wantErr error
+	}{
+		{"all ops", Rules{Grants: []Grant{{Patterns: []string{dir + "/logs/*"}}}}, "logs/app.log", AllOps, nil},
+		{
+			"merged grants",
+			Rules{Grants: []Grant{
+				{Patterns: []string{dir + "/logs/*"}, Ops: []Op{OpTail}},
+				{Patterns: []string{dir + "/logs/*.log"}, Ops: []Op{OpHead, OpTail}},
+			}},
+			"logs/app.log", []Op{OpLs, OpHead, OpTail}, nil,
+		},
+		{"denied", Rules{Grants: []Grant{{Patterns: []string{dir + "/logs/*"}, Deny: []string{"*.key"}}}}, "logs/app.key", nil, ErrorPermissionDeny},
+		{"symlink not followed", Rules{Grants: []Grant{{Patterns: []string{dir + "/**"}}}}, "logs/other.log", nil, ErrorPermissionDeny},
+		{
+			"symlink ops of both sides",
+			Rules{Grants: []Grant{
+				{Patterns: []string{dir + "/logs/*"}, Ops: []Op{OpCat, OpTail}, FollowSymlinks: true},
+				{Patterns: []string{dir + "/other/*"}, Ops: []Op{OpTail, OpGrep}},
+			}},
+			"logs/other.log", []Op{OpLs, OpTail}, nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, got, err := tt.rules.Ops(filepath.Join(dir, tt.path))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Ops() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Ops() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRulesOpsMatchesResolve checks that Ops allows exactly the operations Resolve allows.
+func TestRulesOpsMatchesResolve(t *testing.T) {
+	dir := ruleTree(t)
+	rules := Rules{
+		Grants: []Grant{
+			{Patterns: []string{dir + "/logs/*"}, Ops: []Op{OpCat, OpTail, OpFollow}, FollowSymlinks: true},
+			{Patterns: []string{dir + "/logs/app.*"}, Ops: []Op{OpDownload}},
+			{Patterns: []string{dir + "/other/**", dir + "/secret/**"}, Deny: []string{dir + "/secret"}, Ops: []Op{OpTail, OpGrep}},
+		},
+	}
+	for _, name := range []string{"logs/app.log", "logs/app.key", "logs/other.log", "logs/secret.log", "other/real.log"} {
+		p := filepath.Join(dir, name)
+		_, ops, _ := rules.Ops(p)
+		for _, op := range AllOps {
+			_, err := rules.Resolve(p, op)
+			if allowed := err == nil; allowed != slices.Contains(ops, op) {
+				t.Errorf("%s: Resolve(%s) allowed = %v, Ops() = %v", name, op, allowed, ops)
+			}
+		}
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantErr  error
+	}{
+		{[]string{"/var/log/**/*.log", "*.key", "/var/log/app.{log,txt}"}, nil},
+		{[]string{"/var/log/*.log", "/var/log/[a-"}, ErrorInvalidPattern},
+		{[]string{"/var/log/{a,b"}, ErrorInvalidPattern},
+	}
+	for _, tt := range tests {
+		if err := ValidatePatterns(tt.patterns...); !errors.Is(err, tt.wantErr) {
+			t.Errorf("ValidatePatterns(%q) error = %v, want %v", tt.patterns, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateOps(t *testing.T) {
+	tests := []struct {
+		ops     []string
+		wantErr error
+	}{
+		{nil, nil},
+		{[]string{"tail", "follow", "download"}, nil},
+		{[]string{"tail", "delete"}, ErrorUnknownOp},
+		{[]string{"Tail"}, ErrorUnknownOp},
+	}
+	for _, tt := range tests {
+		if err := ValidateOps(tt.ops); !errors.Is(err, tt.wantErr) {
+			t.Errorf("ValidateOps(%q) error = %v, want %v", tt.ops, err, tt.wantErr)
+		}
+	}
+}
+
+func TestContainsDotDot(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/var/log/app.log", false},
+		{"/var/log/app..log", false},
+		{"/var/log/../secret", true},
+		{"..", true},
+		{`C:\logs\..\secret`, true},
+	}
+	for _, tt := range tests {
+		if got := containsDotDot(tt.path); got != tt.want {
+			t.Errorf("containsDotDot(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
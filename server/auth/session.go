@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/config"
+	"github.com/fmotalleb/timber/server/response"
+)
+
+// ErrorInvalidCookie is returned when a signed cookie is malformed, tampered with or expired.
+var ErrorInvalidCookie = errors.New("invalid cookie")
+
+// randomKey is used to sign cookies when no session secret is configured.
+// It is shared across config reloads of the same process.
+var randomKey = sync.OnceValue(func() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+})
+
+const (
+	// sessionRefreshInterval limits how often the cookie is re-issued to track idle time.
+	sessionRefreshInterval = time.Minute
+	// sessionIDSize is the number of random bytes identifying a session.
+	sessionIDSize = 16
+	// bindSize is the number of bytes of the password binding kept in the cookie.
+	bindSize = 16
+)
+
+// revoked holds the IDs of logged out sessions until they expire.
+// It is shared across config reloads of the same process.
+var revoked = &revocations{ids: make(map[string]int64)}
+
+// revocations is a list of revoked session IDs with their expiry times.
+type revocations struct {
+	mu  sync.Mutex
+	ids map[string]int64
+}
+
+// revoke revokes the session id until it expires, and forgets expired ones.
+func (rv *revocations) revoke(id string, expires int64) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	now := time.Now().Unix()
+	for other, e := range rv.ids {
+		if now > e {
+			delete(rv.ids, other)
+		}
+	}
+	rv.ids[id] = expires
+}
+
+// has reports whether the session id is revoked.
+func (rv *revocations) has(id string) bool {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	_, ok := rv.ids[id]
+	return ok
+}
+
+// session is the payload of the session cookie.
+// Access group names are resolved against the current config on every request;
+// for password sessions they are taken from the current config of the user.
+// Epoch is the session epoch of the config the cookie was issued under.
+// ID identifies the session for logouts, and Bind ties password sessions to
+// the password the user logged in with.
+type session struct {
+	ID       string   `json:"i"`
+	Name     string   `json:"n"`
+	Method   string   `json:"m"`
+	Access   []string `json:"a"`
+	Expires  int64    `json:"e"`
+	LastSeen int64    `json:"l"`
+	Epoch    int      `json:"v,omitempty"`
+	Bind     string   `json:"b,omitempty"`
+}
+
+// Sessions issues and verifies signed session cookies.
+type Sessions struct {
+	cfg      config.Session
+	key      []byte
+	basePath string
+}
+
+// NewSessions creates the session cookie codec from the config.
+// Cookies are scoped to basePath, the URL prefix the server is mounted at.
+func NewSessions(cfg config.Session, basePath string) *Sessions {
+	key := randomKey()
+	if cfg.Secret != "" {
+		sum := sha256.Sum256([]byte(cfg.Secret))
+		key = sum[:]
+	}
+	return &Sessions{cfg: cfg, key: key, basePath: basePath}
+}
+
+// Issue sets a new session cookie for the user.
+func (s *Sessions) Issue(w http.ResponseWriter, r *http.Request, name, method string, access []string) error {
+	return s.issue(w, r, session{Name: name, Method: method, Access: access})
+}
+
+// issue sets a new session cookie for sess, completed with a new ID and the
+// validity of the config.
+func (s *Sessions) issue(w http.ResponseWriter, r *http.Request, sess session) error {
+	id := make([]byte, sessionIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	now := time.Now()
+	sess.ID = base64.RawURLEncoding.EncodeToString(id)
+	sess.Expires = now.Add(s.cfg.Lifetime).Unix()
+	sess.LastSeen = now.Unix()
+	sess.Epoch = s.cfg.Epoch
+	return s.write(w, r, sess)
+}
+
+// bind returns the binding of a password session to the stored password of u,
+// so that changing the password ends the sessions of the user.
+func (s *Sessions) bind(u config.User) string {
+	return base64.RawURLEncoding.EncodeToString(s.mac("password\x00" + u.Name + "\x00" + u.Password)[:bindSize])
+}
+
+func (s *Sessions) write(w http.ResponseWriter, r *http.Request, sess session) error {
+	value, err := s.sign(sess)
+	if err != nil {
+		return err
+	}
+	s.setCookie(w, r, s.cfg.CookieName, value, time.Unix(sess.Expires, 0))
+	return nil
+}
+
+// Clear removes the session cookie.
+func (s *Sessions) Clear(w http.ResponseWriter, r *http.Request) {
+	s.setCookie(w, r, s.cfg.CookieName, "", time.Unix(0, 0))
+}
+
+// read returns the session carried by the request, if any.
+func (s *Sessions) read(r *http.Request) (session, error) {
+	var sess session
+	c, err := r.Cookie(s.cfg.CookieName)
+	if err != nil {
+		return sess, err
+	}
+	if err := s.verify(c.Value, &sess); err != nil {
+		return sess, err
+	}
+	now := time.Now()
+	if now.Unix() > sess.Expires || sess.Epoch != s.cfg.Epoch || sess.ID == "" || revoked.has(sess.ID) {
+		return sess, ErrorInvalidCookie
+	}
+	if s.cfg.IdleTimeout > 0 && now.Sub(time.Unix(sess.LastSeen, 0)) > s.cfg.IdleTimeout {
+		return sess, ErrorInvalidCookie
+	}
+	return sess, nil
+}
+
+// authenticate returns r carrying the user of a valid session cookie and
+// refreshes the cookie's idle timer. It reports false when there is no valid
+// session, or when the user of a password session is no longer configured or
+// has changed their password.
+func (s *Sessions) authenticate(w http.ResponseWriter, r *http.Request, cfg config.Config, users userIndex) (*http.Request, bool) {
+	sess, err := s.read(r)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			log.Of(r.Context()).Warn("invalid session cookie", zap.Error(err))
+		}
+		return r, false
+	}
+	accessList := sess.Access
+	if sess.Method == MethodPassword {
+		u, ok := users[sess.Name]
+		if !ok {
+			log.Of(r.Context()).Warn("session of an unknown user", zap.String("user", sess.Name))
+			return r, false
+		}
+		if !hmac.Equal([]byte(sess.Bind), []byte(s.bind(u))) {
+			log.Of(r.Context()).Warn("session of a changed password", zap.String("user", sess.Name))
+			return r, false
+		}
+		accessList = u.AccessList
+	}
+	if now := time.Now(); now.Sub(time.Unix(sess.LastSeen, 0)) > sessionRefreshInterval {
+		sess.LastSeen = now.Unix()
+		if err := s.write(w, r, sess); err != nil {
+			log.Of(r.Context()).Warn("failed to refresh session cookie", zap.Error(err))
+		}
+	}
+	authUser := &AuthUser{
+		Name:   sess.Name,
+		Method: sess.Method,
+	}
+	return withUser(r, authUser, resolveAccess(cfg, accessList)), true
+}
+
+func (s *Sessions) setCookie(w http.ResponseWriter, r *http.Request, name, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     s.basePath + "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// sign encodes v as `<base64 json>.<base64 hmac>`.
+func (s *Sessions) sign(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload)), nil
+}
+
+// verify checks the signature of a value produced by sign and decodes it into v.
+func (s *Sessions) verify(value string, v any) error {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return ErrorInvalidCookie
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(payload)) {
+		return ErrorInvalidCookie
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrorInvalidCookie
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (s *Sessions) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+// WithSession is a middleware that authenticates requests carrying a valid session cookie.
+// Requests without a session are passed through to the next handler.
+func WithSession(cfg config.Config, sessions *Sessions) func(http.Handler) http.Handler {
+	users := newUserIndex(cfg)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := UserFromContext(r.Context()); !ok {
+				r, _ = sessions.authenticate(w, r, cfg, users)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loginRequest is the body of a password login.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Login verifies a username and password, sent as JSON or form values, and issues a session cookie.
+func Login(cfg config.Config, sessions *Sessions, limiter *Limiter) http.HandlerFunc {
+	users := newUserIndex(cfg)
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := log.Of(r.Context())
+		var req loginRequest
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+		} else {
+			req.Username = r.FormValue("username")
+			req.Password = r.FormValue("password")
+		}
+
+		if !limiter.guard(w, r, userKey(req.Username)) {
+			return
+		}
+		u, ok := users.verify(req.Username, req.Password)
+		if !ok {
+			logger.Warn("login failed", zap.String("user", req.Username))
+			limiter.fail(r, userKey(req.Username))
+			// No WWW-Authenticate challenge, so browsers do not prompt.
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		limiter.succeed(r, userKey(req.Username))
+		sess := session{Name: u.Name, Method: MethodPassword, Access: u.AccessList, Bind: sessions.bind(u)}
+		if err := sessions.issue(w, r, sess); err != nil {
+			logger.Error("failed to issue session", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		access := resolveAccess(cfg, u.AccessList)
+		authUser := &AuthUser{
+			Name:   u.Name,
+			Method: MethodPassword,
+			Access: access.Allow(),
+			Deny:   access.Deny(),
+		}
+		if err := response.JSON(w, authUser, http.StatusOK); err != nil {
+			logger.Error("failed to write response", zap.Error(err))
+		}
+	}
+}
+
+// Logout revokes the session of the request, if any, and clears the session cookie.
+func Logout(sessions *Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sess, err := sessions.read(r); err == nil {
+			revoked.revoke(sess.ID, sess.Expires)
+		}
+		sessions.Clear(w, r)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// isSecure reports whether the client connected over HTTPS. X-Forwarded-Proto
+// only reaches here from trusted proxies, as other peers' is removed beforehand.
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fmotalleb/timber/config"
+)
+
+var testSession = config.Session{
+	Secret:      "secret",
+	CookieName:  "timber_session",
+	Lifetime:    12 * time.Hour,
+	IdleTimeout: 30 * time.Minute,
+	Epoch:       1,
+}
+
+// sessionRequest returns a request carrying sess, signed by s, as its cookie.
+func sessionRequest(t *testing.T, s *Sessions, sess session) *http.Request {
+	t.Helper()
+	value, err := s.sign(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: testSession.CookieName, Value: value})
+	return r
+}
+
+func TestSessionsSignVerify(t *testing.T) {
+	s := NewSessions(testSession, "")
+	value, err := s.sign(session{Name: "alice", Method: MethodPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _, _ := strings.Cut(value, ".")
+	other := testSession
+	other.Secret = "other"
+
+	tests := []struct {
+		name     string
+		sessions *Sessions
+		value    string
+		wantErr  bool
+	}{
+		{"valid", s, value, false},
+		{"other key", NewSessions(other, ""), value, true},
+		{"tampered payload", s, "x" + value, true},
+		{"tampered signature", s, value + "x", true},
+		{"no signature", s, payload, true},
+		{"empty", s, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got session
+			err := tt.sessions.verify(tt.value, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verify() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && got.Name != "alice" {
+				t.Errorf("verify() name = %q, want %q", got.Name, "alice")
+			}
+		})
+	}
+}
+
+func TestSessionsRead(t *testing.T) {
+	now := time.Now()
+	valid := session{
+		ID:       "id",
+		Name:     "alice",
+		Method:   MethodPassword,
+		Expires:  now.Add(time.Hour).Unix(),
+		LastSeen: now.Add(-time.Minute).Unix(),
+		Epoch:    testSession.Epoch,
+	}
+	tests := []struct {
+		name    string
+		cfg     func(*config.Session)
+		sess    func(*session)
+		wantErr bool
+	}{
+		{"valid", nil, nil, false},
+		{"expired", nil, func(s *session) { s.Expires = now.Add(-time.Second).Unix() }, true},
+		{"idle", nil, func(s *session) { s.LastSeen = now.Add(-time.Hour).Unix() }, true},
+		{"idle check disabled", func(c *config.Session) { c.IdleTimeout = -1 }, func(s *session) { s.LastSeen = now.Add(-time.Hour).Unix() }, false},
+		{"older epoch", nil, func(s *session) { s.Epoch = 0 }, true},
+		{"epoch raised", func(c *config.Session) { c.Epoch = 2 }, nil, true},
+		{"no id", nil, func(s *session) { s.ID = "" }, true},
+		{"revoked", nil, func(s *session) { s.ID = "revoked" }, true},
+	}
+	revoked.revoke("revoked", now.Add(time.Hour).Unix())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, sess := testSession, valid
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			if tt.sess != nil {
+				tt.sess(&sess)
+			}
+			s := NewSessions(cfg, "")
+			_, err := s.read(sessionRequest(t, s, sess))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("read() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrorInvalidCookie) {
+				t.Errorf("read() error = %v, want %v", err, ErrorInvalidCookie)
+			}
+		})
+	}
+}
+
+func TestSessionsAuthenticate(t *testing.T) {
+	cfg := config.Config{
+		Users: []config.User{{Name: "alice", Password: "hash", AccessList: []string{"app"}}},
+		Access: map[string]config.Access{
+			"app": {Paths: []string{"/var/log/app/**"}},
+			"sys": {Paths: []string{"/var/log/sys/**"}},
+		},
+		Session: testSession,
+	}
+	s := NewSessions(cfg.Session, "")
+	bind := s.bind(cfg.Users[0])
+	changed := s.bind(config.User{Name: "alice", Password: "old hash"})
+	now := time.Now()
+	tests := []struct {
+		name       string
+		sess       session
+		wantOK     bool
+		wantAccess []string
+	}{
+		{
+			"password session uses the current access of the user",
+			session{Name: "alice", Method: MethodPassword, Access: []string{"sys"}, Bind: bind},
+			true, []string{"/var/log/app/**"},
+		},
+		{"password session of a removed user", session{Name: "bob", Method: MethodPassword, Access: []string{"app"}, Bind: bind}, false, nil},
+		{"password session of a changed password", session{Name: "alice", Method: MethodPassword, Bind: changed}, false, nil},
+		{"password session without binding", session{Name: "alice", Method: MethodPassword}, false, nil},
+		{"oidc session keeps its access", session{Name: "carol", Method: MethodOIDC, Access: []string{"sys"}}, true, []string{"/var/log/sys/**"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := tt.sess
+			sess.ID, sess.Expires, sess.LastSeen, sess.Epoch = "id", now.Add(time.Hour).Unix(), now.Unix(), cfg.Session.Epoch
+			r, ok := s.authenticate(httptest.NewRecorder(), sessionRequest(t, s, sess), cfg, newUserIndex(cfg))
+			if ok != tt.wantOK {
+				t.Fatalf("authenticate() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			u, _ := UserFromContext(r.Context())
+			if u.Name != sess.Name || !slices.Equal(u.Access, tt.wantAccess) {
+				t.Errorf("authenticate() user = %q with %v, want %q with %v", u.Name, u.Access, sess.Name, tt.wantAccess)
+			}
+		})
+	}
+}
+
+func TestSessionsRefresh(t *testing.T) {
+	cfg := config.Config{Session: testSession}
+	s := NewSessions(cfg.Session, "")
+	now := time.Now()
+	tests := []struct {
+		name        string
+		lastSeen    time.Time
+		wantRefresh bool
+	}{
+		{"recently seen", now, false},
+		{"seen before the refresh interval", now.Add(-2 * sessionRefreshInterval), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := session{
+				ID:       "id",
+				Name:     "carol",
+				Method:   MethodOIDC,
+				Expires:  now.Add(time.Hour).Unix(),
+				LastSeen: tt.lastSeen.Unix(),
+				Epoch:    cfg.Session.Epoch,
+			}
+			w := httptest.NewRecorder()
+			if _, ok := s.authenticate(w, sessionRequest(t, s, sess), cfg, nil); !ok {
+				t.Fatal("authenticate() ok = false, want true")
+			}
+			if refreshed := len(w.Header().Values("Set-Cookie")) > 0; refreshed != tt.wantRefresh {
+				t.Errorf("cookie refreshed = %v, want %v", refreshed, tt.wantRefresh)
+			}
+		})
+	}
+}
+
+func TestLogoutRevokes(t *testing.T) {
+	s := NewSessions(testSession, "")
+	w := httptest.NewRecorder()
+	if err := s.Issue(w, httptest.NewRequest(http.MethodPost, "/", nil), "carol", MethodOIDC, nil); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	if _, err := s.read(r); err != nil {
+		t.Fatalf("read() error = %v before logout, want nil", err)
+	}
+	Logout(s)(httptest.NewRecorder(), r)
+	if _, err := s.read(r); !errors.Is(err, ErrorInvalidCookie) {
+		t.Errorf("read() error = %v after logout, want %v", err, ErrorInvalidCookie)
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/config"
+	"github.com/fmotalleb/timber/server/response"
+)
+
+// status describes the available login methods and the current session, if any.
+type status struct {
+	OIDC bool      `json:"oidc"`
+	User *AuthUser `json:"user"`
+}
+
+// Status returns the login methods of the server and the user of a preceding
+// authenticator, without challenging unauthenticated clients.
+func Status(cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		s := status{
+			OIDC: cfg.OIDC.Enabled(),
+			User: user,
+		}
+		if err := response.JSON(w, s, http.StatusOK); err != nil {
+			log.Of(r.Context()).Error("failed to write response", zap.Error(err))
+		}
+	}
+}
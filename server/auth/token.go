@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/config"
+	"github.com/fmotalleb/timber/server/auth/passwd"
+	"github.com/fmotalleb/timber/server/response"
+)
+
+const bearerPrefix = "Bearer "
+
+// WithBearerToken is a middleware that authenticates API tokens sent as
+// `Authorization: Bearer <name>.<secret>`.
+// Requests without a bearer token, and requests already authenticated, are passed
+// through to the next authenticator.
+// Failed attempts are throttled by the limiter.
+func WithBearerToken(cfg config.Config, limiter *Limiter) func(http.Handler) http.Handler {
+	tokens := make(map[string]config.Token, len(cfg.Tokens))
+	for _, t := range cfg.Tokens {
+		tokens[t.Name] = t
+	}
+	// Unknown token names are verified against a configured secret, so they
+	// take as long to reject as wrong secrets.
+	dummy := config.Token{}
+	if len(cfg.Tokens) > 0 {
+		dummy.Secret = cfg.Tokens[0].Secret
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if _, ok := UserFromContext(r.Context()); ok ||
+				len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			logger := log.Of(r.Context())
+
+			name, secret, ok := strings.Cut(strings.TrimSpace(header[len(bearerPrefix):]), ".")
+			if !ok {
+				logger.Warn("malformed bearer token")
+				response.Unauthorized(w)
+				return
+			}
+			if !limiter.guard(w, r, tokenKey(name)) {
+				return
+			}
+			t, ok := tokens[name]
+			if !ok {
+				t = dummy
+			}
+			if !passwd.Verify(t.Secret, secret) || !ok {
+				logger.Warn("token authentication failed", zap.String("token", name))
+				limiter.fail(r, tokenKey(name))
+				response.Unauthorized(w)
+				return
+			}
+			if !t.Expires.IsZero() && time.Now().After(t.Expires) {
+				logger.Warn("token expired", zap.String("token", name), zap.Time("expires", t.Expires))
+				limiter.fail(r, tokenKey(name))
+				response.Unauthorized(w)
+				return
+			}
+			limiter.succeed(r, tokenKey(name))
+
+			authUser := &AuthUser{
+				Name:   t.Name,
+				Method: MethodToken,
+				Token:  t.Name,
+			}
+			next.ServeHTTP(w, withUser(r, authUser, resolveAccess(cfg, t.AccessList)))
+		})
+	}
+}
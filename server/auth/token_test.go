@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fmotalleb/timber/config"
+)
+
+func TestWithBearerToken(t *testing.T) {
+	cfg := config.Config{
+		Tokens: []config.Token{
+			{Name: "ci", Secret: "s3cret", AccessList: []string{"app"}},
+			{Name: "valid", Secret: "s3cret", Expires: time.Now().Add(time.Hour)},
+			{Name: "expired", Secret: "s3cret", Expires: time.Now().Add(-time.Second)},
+		},
+		Access: map[string]config.Access{"app": {Paths: []string{"/var/log/app/**"}}},
+	}
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantUser   string
+	}{
+		{"no expiry", "Bearer ci.s3cret", http.StatusOK, "ci"},
+		{"case-insensitive scheme", "bearer ci.s3cret", http.StatusOK, "ci"},
+		{"not expired", "Bearer valid.s3cret", http.StatusOK, "valid"},
+		{"expired", "Bearer expired.s3cret", http.StatusUnauthorized, ""},
+		{"wrong secret", "Bearer ci.wrong", http.StatusUnauthorized, ""},
+		{"unknown token", "Bearer other.s3cret", http.StatusUnauthorized, ""},
+		{"malformed", "Bearer ci", http.StatusUnauthorized, ""},
+		{"no token", "", http.StatusOK, ""},
+		{"basic credentials", "Basic dTpw", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user string
+			next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				if u, ok := UserFromContext(r.Context()); ok {
+					user = u.Name
+				}
+			})
+			handler := WithBearerToken(cfg, NewLimiter(config.Lockout{MaxFailures: -1}))(next)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if user != tt.wantUser {
+				t.Errorf("user = %q, want %q", user, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestWithBearerTokenAccess(t *testing.T) {
+	cfg := config.Config{
+		Tokens: []config.Token{{Name: "ci", Secret: "s3cret", AccessList: []string{"app"}}},
+		Access: map[string]config.Access{"app": {Paths: []string{"/var/log/app/**"}}},
+	}
+	var access Rules
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		access, _ = AccessFromContext(r.Context())
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer ci.s3cret")
+	WithBearerToken(cfg, NewLimiter(config.Lockout{MaxFailures: -1}))(next).ServeHTTP(httptest.NewRecorder(), r)
+	if !access.Allowed("/var/log/app/app.log", OpCat) || access.Allowed("/var/log/sys/syslog", OpCat) {
+		t.Errorf("token access = %+v, want the access group app", access)
+	}
+}
+
+func TestWithBearerTokenLockout(t *testing.T) {
+	cfg := config.Config{Tokens: []config.Token{{Name: "ci", Secret: "s3cret"}}}
+	handler := WithBearerToken(cfg, NewLimiter(testLockout))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	tests := []struct {
+		header     string
+		wantStatus int
+	}{
+		{"Bearer ci.wrong", http.StatusUnauthorized},
+		// The failure blocks the token, even with the right secret.
+		{"Bearer ci.s3cret", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", tt.header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.header, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestWithBearerTokenExpiredFails(t *testing.T) {
+	cfg := config.Config{Tokens: []config.Token{{Name: "old", Secret: "s3cret", Expires: time.Now().Add(-time.Second)}}}
+	limiter := NewLimiter(testLockout)
+	handler := WithBearerToken(cfg, limiter)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer old.s3cret")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if got := limiter.entries[tokenKey("old")]; got == nil || got.failures != 1 {
+		t.Errorf("expired token attempts = %+v, want one failure", got)
+	}
+}
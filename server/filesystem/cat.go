@@ -2,21 +2,75 @@
 package filesystem
 
 import (
+	"io"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
 
 	"github.com/fmotalleb/timber/server/helper"
 )
 
 // Cat serves a file to the client.
+// Compressed files are served as they are, unless `decompress` is set.
 func Cat(w http.ResponseWriter, r *http.Request) {
 	filePath, ok := helper.GetPath(r)
 	if !ok {
 		http.Error(w, "file path is missing from request, your request must contain `path` query parameter", http.StatusBadRequest)
 		return
 	}
-	if containsDotDot(filePath) {
-		http.Error(w, "invalid path", http.StatusBadRequest)
+	if helper.GetFlag(r, "decompress") {
+		catDecompressed(w, r, filePath)
 		return
 	}
+	if helper.GetFlag(r, "download") {
+		setAttachment(w, filepath.Base(filePath))
+	}
 	http.ServeFile(w, r, filePath)
 }
+
+// catDecompressed serves the decompressed content of a compressed file, and plain files as they are.
+func catDecompressed(w http.ResponseWriter, r *http.Request, filePath string) {
+	logger := log.Of(r.Context())
+	f, err := os.Open(filePath)
+	if err != nil {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	src, c, err := textReader(f)
+	if err != nil {
+		logger.Error("failed to read file", zap.Error(err))
+		http.Error(w, "failed to read file", http.StatusUnprocessableEntity)
+		return
+	}
+	defer src.Close()
+	if c == nil {
+		if helper.GetFlag(r, "download") {
+			setAttachment(w, filepath.Base(filePath))
+		}
+		http.ServeFile(w, r, filePath)
+		return
+	}
+
+	if helper.GetFlag(r, "download") {
+		setAttachment(w, strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)))
+	}
+	setCompressionHeader(w, c)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err = io.Copy(w, src); err != nil {
+		logger.Warn("failed to write response", zap.Error(err))
+	}
+}
+
+// setAttachment makes the response a download named filename.
+func setAttachment(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": filename,
+	}))
+}
@@ -0,0 +1,229 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compression is a compression format detected by its magic bytes.
+type compression struct {
+	Name  string
+	magic []byte
+	open  func(io.Reader) (io.ReadCloser, error)
+}
+
+var compressions = []compression{
+	{
+		Name:  "gzip",
+		magic: []byte{0x1f, 0x8b},
+		open: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		Name:  "bzip2",
+		magic: []byte("BZh"),
+		open: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	},
+	{
+		Name:  "xz",
+		magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		open: func(r io.Reader) (io.ReadCloser, error) {
+			x, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return io.NopCloser(x), nil
+		},
+	},
+	{
+		Name:  "zstd",
+		magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		open: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	},
+}
+
+const (
+	// maxMagicLen is the length of the longest magic number.
+	maxMagicLen = 6
+	// maxDecompressedSize bounds the decompressed content of a file, so that
+	// a small compressed file can not expand without limit.
+	maxDecompressedSize = 4 << 30
+)
+
+var errDecompressedTooLarge = errors.New("decompressed content is too large")
+
+// detectCompression returns the compression of f by its magic bytes, or nil for a plain file.
+func detectCompression(f *os.File) (*compression, error) {
+	head := make([]byte, maxMagicLen)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for i := range compressions {
+		if bytes.HasPrefix(head[:n], compressions[i].magic) {
+			return &compressions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// textReader returns a reader of the text content of f from its start,
+// decompressing it when it is compressed. The compression is nil for plain files.
+// Closing the reader does not close f.
+func textReader(f *os.File) (io.ReadCloser, *compression, error) {
+	c, err := detectCompression(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	if c == nil {
+		return io.NopCloser(f), nil, nil
+	}
+	r, err := c.open(bufio.NewReaderSize(f, readChunkSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &boundedReader{ReadCloser: r, n: maxDecompressedSize}, c, nil
+}
+
+// boundedReader reads at most n bytes of a decompressed stream and fails with
+// errDecompressedTooLarge when the stream has more.
+type boundedReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		var one [1]byte
+		if n, err := io.ReadFull(b.ReadCloser, one[:]); n == 0 {
+			return 0, err
+		}
+		return 0, errDecompressedTooLarge
+	}
+	if int64(len(p)) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= int64(n)
+	return n, err
+}
+
+// setCompressionHeader reports the compression of a decompressed file to the client.
+func setCompressionHeader(w http.ResponseWriter, c *compression) {
+	if c != nil {
+		w.Header().Set("X-Decompressed-From", c.Name)
+	}
+}
+
+// tailStream returns the last n lines of r, without their line endings.
+// It is used for files that can not be read backwards, such as compressed ones.
+func tailStream(r io.Reader, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	reader := bufio.NewReaderSize(r, readChunkSize)
+	var ring []string
+	next := 0
+	for {
+		line, err := readLine(reader)
+		if len(line) > 0 || err == nil {
+			if len(ring) < n {
+				ring = append(ring, string(line))
+			} else {
+				ring[next] = string(line)
+			}
+			next = (next + 1) % n
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+	}
+	if len(ring) < n {
+		return ring, nil
+	}
+	return append(ring[next:], ring[:next]...), nil
+}
+
+// tailCompressed returns the last n lines of a compressed file.
+func tailCompressed(f *os.File, n int) ([]string, error) {
+	src, _, err := textReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return tailStream(src, n)
+}
+
+// compressedRange finds a line or byte range in the decompressed content of f
+// and returns its content.
+func compressedRange(f *os.File, byteMode bool, from, to int64) (lineRange, []byte, error) {
+	src, _, err := textReader(f)
+	if err != nil {
+		return lineRange{}, nil, err
+	}
+	defer src.Close()
+	return streamRange(src, byteMode, from, to)
+}
+
+// streamRange finds a line or byte range in r, read from its start, and
+// returns its content, read in the same pass. The range ends early once it
+// holds maxRangeBytes.
+func streamRange(r io.Reader, byteMode bool, from, to int64) (lineRange, []byte, error) {
+	var (
+		buf             bytes.Buffer
+		n, offset, kept int64
+	)
+	lr := lineRange{FirstLine: from, Start: -1}
+	if byteMode {
+		lr.FirstLine = 0
+	}
+	err := scanLines(io.TeeReader(r, &buf), 0, func(start, end int64) bool {
+		n++
+		offset = end
+		if byteMode && end <= from || !byteMode && n < from {
+			// Drop the lines before the range as soon as they are read.
+			buf.Next(int(end - kept))
+			kept = end
+			return true
+		}
+		if lr.Start < 0 {
+			lr.Start = start
+		}
+		lr.LastStart, lr.End = start, end
+		if end-lr.Start >= maxRangeBytes {
+			return false
+		}
+		if byteMode {
+			return end < to
+		}
+		return n < to
+	})
+	if lr.Start < 0 {
+		return lineRange{Start: offset, LastStart: offset, End: offset}, nil, err
+	}
+	return lr, buf.Bytes()[:lr.End-kept], err
+}
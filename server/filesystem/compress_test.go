@@ -0,0 +1,64 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTailStream(t *testing.T) {
+	tests := []struct {
+		content string
+		n       int
+		want    []string
+	}{
+		{"one\ntwo\nthree\n", 2, []string{"two", "three"}},
+		{"one\ntwo\nthree", 2, []string{"two", "three"}},
+		{"one\ntwo\n", 5, []string{"one", "two"}},
+		{"one\n\ntwo\n", 2, []string{"", "two"}},
+		{"", 3, nil},
+		{"one\n", 0, nil},
+	}
+	for _, tt := range tests {
+		got, err := tailStream(strings.NewReader(tt.content), tt.n)
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("tailStream(%q, %d) = %q, %v, want %q", tt.content, tt.n, got, err, tt.want)
+		}
+	}
+}
+
+func TestBoundedReader(t *testing.T) {
+	tests := []struct {
+		content string
+		n       int64
+		want    string
+		err     error
+	}{
+		{"abc", 5, "abc", nil},
+		{"abc", 3, "abc", nil},
+		{"abcd", 3, "abc", errDecompressedTooLarge},
+		{"", 0, "", nil},
+	}
+	for _, tt := range tests {
+		br := &boundedReader{ReadCloser: io.NopCloser(strings.NewReader(tt.content)), n: tt.n}
+		got, err := io.ReadAll(br)
+		if string(got) != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("read %q bounded to %d = %q, %v, want %q, %v", tt.content, tt.n, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestStreamRangeLimit(t *testing.T) {
+	line := strings.Repeat("x", 1<<20-1) + "\n"
+	content := strings.Repeat(line, 20)
+	lr, got, err := streamRange(strings.NewReader(content), false, 2, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lineRange{FirstLine: 2, Start: 1 << 20, LastStart: 16 << 20, End: 17 << 20}
+	if lr != want || int64(len(got)) != lr.End-lr.Start {
+		t.Errorf("streamRange() = %+v with %d bytes, want %+v with %d bytes", lr, len(got), want, want.End-want.Start)
+	}
+}
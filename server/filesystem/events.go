@@ -0,0 +1,135 @@
+package filesystem
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+)
+
+// wantsEvents reports whether the client asked for Server-Sent Events, as EventSource does.
+func wantsEvents(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// eventsStart returns the offset to stream f from: the Last-Event-ID of a
+// reconnecting client, or the start of the last n complete lines. Event ids
+// are offsets in the file they name, as `<offset>@<file>`. When f is not that
+// file any more, or shrank below the offset, it starts over and returns the
+// rotation or truncation to report first.
+func eventsStart(r *http.Request, f *os.File, n int) (int64, followEvent, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		start, err := lastLinesStart(f, n)
+		return start, followData, err
+	}
+	offset, file, _ := strings.Cut(v, "@")
+	id, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil || id < 0 {
+		return 0, followData, errInvalidEventID
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, followData, err
+	}
+	if file != fileIdentity(info) {
+		return 0, followRotated, nil
+	}
+	start, truncated, err := resumeOffset(f, id)
+	switch {
+	case errors.Is(err, errNotLineStart):
+		return 0, followData, errInvalidEventID
+	case truncated:
+		return 0, followTruncated, err
+	}
+	return start, followData, err
+}
+
+var errInvalidEventID = errors.New("invalid `Last-Event-ID` header")
+
+// appendEvent encodes l as a Server-Sent Event whose id is the offset right
+// after the line in its file, so a reconnecting client's Last-Event-ID is
+// where reading resumes.
+func appendEvent(out []byte, l followedLine) []byte {
+	data := l.Text
+	switch l.Event {
+	case followRotated:
+		out, data = append(out, "event: rotated\n"...), []byte(rotationMarker)
+	case followTruncated:
+		out, data = append(out, "event: truncated\n"...), []byte(truncationMarker)
+	}
+	out = strconv.AppendInt(append(out, "id: "...), l.End, 10)
+	if l.File != "" {
+		out = append(append(out, '@'), l.File...)
+	}
+	// A carriage return would end the data field early.
+	out = append(append(out, "\ndata: "...), bytes.ReplaceAll(data, []byte("\r"), nil)...)
+	return append(out, "\n\n"...)
+}
+
+// followEvents streams f, opened from path, as Server-Sent Events: the last n
+// complete lines, or the lines after Last-Event-ID, then the lines appended to
+// it. Rotation and truncation are sent as `rotated` and `truncated` events.
+func followEvents(w http.ResponseWriter, r *http.Request, f *os.File, path string, n int) {
+	logger := log.Of(r.Context())
+	start, event, err := eventsStart(r, f, n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err = f.Seek(start, io.SeekStart); err != nil {
+		logger.Error("failed to read file", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	fl, err := newFollower(path, f)
+	if err != nil {
+		logger.Error("failed to follow file", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer fl.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return
+	}
+
+	var out []byte
+	if event != followData {
+		out = appendEvent(out, followedLine{Event: event, File: fl.file()})
+	}
+	write := func() error {
+		_, werr := w.Write(out)
+		out = out[:0]
+		return werr
+	}
+	err = followLines(r.Context(), fl, func(l followedLine) error {
+		out = appendEvent(out, l)
+		if len(out) < readChunkSize {
+			return nil
+		}
+		return write()
+	}, func() error {
+		// Caught up: send what was read before waiting for more.
+		if werr := write(); werr != nil {
+			return werr
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		logger.Warn("failed to follow file", zap.Error(err))
+	}
+}
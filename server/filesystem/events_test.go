@@ -0,0 +1,71 @@
+package filesystem
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestEventsStart(t *testing.T) {
+	dir := t.TempDir()
+	p := writeTestFile(t, dir, "app.log", "one\ntwo\nthree\n")
+	other := writeTestFile(t, dir, "other.log", "")
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	id := func(path string, offset int64) string {
+		info, serr := os.Stat(path)
+		if serr != nil {
+			t.Fatal(serr)
+		}
+		return strconv.FormatInt(offset, 10) + "@" + fileIdentity(info)
+	}
+	tests := []struct {
+		name   string
+		lastID string
+		start  int64
+		event  followEvent
+		err    error
+	}{
+		{"last lines", "", 4, followData, nil},
+		{"resume", id(p, 8), 8, followData, nil},
+		{"resume at the end", id(p, 14), 14, followData, nil},
+		{"other file", id(other, 8), 0, followRotated, nil},
+		{"shrank", id(p, 100), 0, followTruncated, nil},
+		{"inside a line", id(p, 6), 0, followData, errInvalidEventID},
+		{"not a number", "x", 0, followData, errInvalidEventID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.lastID != "" {
+				r.Header.Set("Last-Event-ID", tt.lastID)
+			}
+			start, event, err := eventsStart(r, f, 2)
+			if start != tt.start || event != tt.event || !errors.Is(err, tt.err) {
+				t.Errorf("eventsStart() = %d, %v, %v, want %d, %v, %v", start, event, err, tt.start, tt.event, tt.err)
+			}
+		})
+	}
+}
+
+func TestAppendEvent(t *testing.T) {
+	tests := []struct {
+		line followedLine
+		want string
+	}{
+		{followedLine{End: 4, File: "803-1a", Text: []byte("one\r")}, "id: 4@803-1a\ndata: one\n\n"},
+		{followedLine{Event: followRotated, File: "803-1b"}, "event: rotated\nid: 0@803-1b\ndata: " + rotationMarker + "\n\n"},
+		{followedLine{End: 4, Text: []byte("one")}, "id: 4\ndata: one\n\n"},
+	}
+	for _, tt := range tests {
+		if got := string(appendEvent(nil, tt.line)); got != tt.want {
+			t.Errorf("appendEvent(%+v) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
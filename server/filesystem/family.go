@@ -0,0 +1,245 @@
+package filesystem
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fmotalleb/timber/server/auth"
+	"github.com/fmotalleb/timber/server/helper"
+)
+
+// rotatedSuffix matches the suffix that log rotation appends to a file name: a
+// number (app.log.1) or a date (app.log-20240501, app.log.2024-05-01), maybe
+// followed by a compression extension.
+var rotatedSuffix = regexp.MustCompile(
+	`(?:\.(\d{1,4})|[.-](\d{4}-?\d{2}-?\d{2}(?:[-_T]?\d{2,6})?))(?:\.(?:gz|bz2|xz|zst))?$`,
+)
+
+// rotation orders the members of a rotation family. Dated members are older
+// than numbered ones, which get older as their number grows.
+type rotation struct {
+	date   string
+	number int
+}
+
+func (a rotation) compare(b rotation) int {
+	switch {
+	case a.date != "" && b.date != "":
+		return strings.Compare(a.date, b.date)
+	case a.date != "":
+		return -1
+	case b.date != "":
+		return 1
+	}
+	return b.number - a.number
+}
+
+// splitRotated splits a rotated file name into the name of its log and its rotation.
+func splitRotated(name string) (string, rotation, bool) {
+	m := rotatedSuffix.FindStringSubmatchIndex(name)
+	if m == nil || m[0] == 0 {
+		return "", rotation{}, false
+	}
+	var rot rotation
+	if m[2] >= 0 {
+		rot.number, _ = strconv.Atoi(name[m[2]:m[3]])
+	} else {
+		rot.date = strings.NewReplacer("-", "", "_", "", "T", "").Replace(name[m[4]:m[5]])
+	}
+	return name[:m[0]], rot, true
+}
+
+// rotatedSiblings returns the rotated files of the log name in its directory, oldest first.
+func rotatedSiblings(name string) []string {
+	dir, base := filepath.Split(name)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	type sibling struct {
+		name string
+		rot  rotation
+	}
+	var siblings []sibling
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if b, rot, ok := splitRotated(e.Name()); ok && b == base {
+			siblings = append(siblings, sibling{name: filepath.Join(dir, e.Name()), rot: rot})
+		}
+	}
+	slices.SortFunc(siblings, func(a, b sibling) int { return a.rot.compare(b.rot) })
+	paths := make([]string, len(siblings))
+	for i, s := range siblings {
+		paths[i] = s.name
+	}
+	return paths
+}
+
+// familyMembers returns the files to read for a request with `family=true`:
+// the rotated files of the requested log that the user may perform op on,
+// oldest first, and the log itself. It returns nil without the flag.
+func familyMembers(r *http.Request, op auth.Op) []string {
+	if !helper.GetFlag(r, "family") {
+		return nil
+	}
+	resolved, ok := helper.GetPath(r)
+	if !ok {
+		return nil
+	}
+	var members []string
+	for _, name := range rotatedSiblings(r.URL.Query().Get("path")) {
+		if p, err := auth.Authorize(r.Context(), name, op); err == nil {
+			members = append(members, p)
+		}
+	}
+	return append(members, resolved)
+}
+
+// groupFamilies folds listed rotated files into the entry of their log, when
+// it is listed too, as its Members, oldest first.
+func groupFamilies(entries []entry) []entry {
+	logs := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		logs[e.Path] = !e.IsDir
+	}
+	rotations := make(map[string]rotation)
+	grouped := make([]entry, 0, len(entries))
+	members := make(map[string][]entry)
+	for _, e := range entries {
+		if base, rot, ok := splitRotated(e.Path); ok && !e.IsDir {
+			if logs[base] {
+				members[base] = append(members[base], e)
+				rotations[e.Path] = rot
+				continue
+			}
+		}
+		grouped = append(grouped, e)
+	}
+	for i := range grouped {
+		m := members[grouped[i].Path]
+		slices.SortFunc(m, func(a, b entry) int { return rotations[a.Path].compare(rotations[b.Path]) })
+		grouped[i].Members = m
+	}
+	return grouped
+}
+
+// familyReader reads the text content of several files in turn, decompressing
+// compressed ones. A file that does not end with a newline is followed by one,
+// so its last line does not run into the first line of the next.
+type familyReader struct {
+	paths   []string
+	f       *os.File
+	r       io.ReadCloser
+	newline bool
+}
+
+func newFamilyReader(paths []string) *familyReader {
+	return &familyReader{paths: paths}
+}
+
+func (fr *familyReader) Read(p []byte) (int, error) {
+	for {
+		if fr.r == nil {
+			if len(fr.paths) == 0 {
+				return 0, io.EOF
+			}
+			if fr.newline && len(p) > 0 {
+				fr.newline = false
+				p[0] = '\n'
+				return 1, nil
+			}
+			if err := fr.next(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := fr.r.Read(p)
+		if n > 0 {
+			fr.newline = p[n-1] != '\n'
+		}
+		if errors.Is(err, io.EOF) {
+			fr.Close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// next opens the next file.
+func (fr *familyReader) next() error {
+	f, err := os.Open(fr.paths[0])
+	if err != nil {
+		return err
+	}
+	fr.paths = fr.paths[1:]
+	r, _, err := textReader(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fr.f, fr.r = f, r
+	return nil
+}
+
+// Close closes the file being read.
+func (fr *familyReader) Close() error {
+	if fr.r == nil {
+		return nil
+	}
+	fr.r.Close()
+	err := fr.f.Close()
+	fr.f, fr.r = nil, nil
+	return err
+}
+
+// familyRange finds a line or byte range in the content of the files, read in
+// turn, and returns its content. Its offsets count from the start of the oldest
+// file, so they shift when that file is pruned.
+func familyRange(paths []string, byteMode bool, from, to int64) (lineRange, []byte, error) {
+	src := newFamilyReader(paths)
+	defer src.Close()
+	return streamRange(src, byteMode, from, to)
+}
+
+// tailFamily returns the last n lines of the files, read newest first until
+// enough lines were found.
+func tailFamily(paths []string, n int) ([]string, error) {
+	var lines []string
+	for i := len(paths) - 1; i >= 0 && len(lines) < n; i-- {
+		more, err := tailFile(paths[i], n-len(lines))
+		if err != nil {
+			return nil, err
+		}
+		lines = append(more, lines...)
+	}
+	return lines, nil
+}
+
+// tailFile returns the last n lines of the file at path, decompressing it when
+// it is compressed.
+func tailFile(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := detectCompression(f)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		return tailCompressed(f, n)
+	}
+	return tailLines(f, n)
+}
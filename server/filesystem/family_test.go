@@ -0,0 +1,113 @@
+package filesystem
+
+import (
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSplitRotated(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		rot  rotation
+		ok   bool
+	}{
+		{"app.log.1", "app.log", rotation{number: 1}, true},
+		{"app.log.12.gz", "app.log", rotation{number: 12}, true},
+		{"app.log.3.bz2", "app.log", rotation{number: 3}, true},
+		{"app.log-20240501", "app.log", rotation{date: "20240501"}, true},
+		{"app.log-20240501.zst", "app.log", rotation{date: "20240501"}, true},
+		{"app.log.2024-05-01.gz", "app.log", rotation{date: "20240501"}, true},
+		{"app.log-2024-05-01_13", "app.log", rotation{date: "2024050113"}, true},
+		{"app.log-20240501T1300", "app.log", rotation{date: "202405011300"}, true},
+		{"/var/log/syslog.2", "/var/log/syslog", rotation{number: 2}, true},
+		{"app.log", "", rotation{}, false},
+		{"app.log.gz", "", rotation{}, false},
+		{"app.log.12345", "", rotation{}, false},
+		{"app.log-2024", "", rotation{}, false},
+		{".1", "", rotation{}, false},
+	}
+	for _, tt := range tests {
+		base, rot, ok := splitRotated(tt.name)
+		if base != tt.base || rot != tt.rot || ok != tt.ok {
+			t.Errorf("splitRotated(%q) = %q, %+v, %v, want %q, %+v, %v", tt.name, base, rot, ok, tt.base, tt.rot, tt.ok)
+		}
+	}
+}
+
+func TestRotationCompare(t *testing.T) {
+	// Oldest first.
+	want := []rotation{
+		{date: "20240501"},
+		{date: "20240502"},
+		{number: 10},
+		{number: 2},
+		{number: 1},
+	}
+	got := []rotation{want[3], want[0], want[4], want[2], want[1]}
+	slices.SortFunc(got, rotation.compare)
+	if !slices.Equal(got, want) {
+		t.Errorf("sorted rotations = %+v, want %+v", got, want)
+	}
+}
+
+func TestRotatedSiblings(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"app.log", "app.log.1", "app.log.2.gz", "app.log-20240501.gz", "other.log.1", "app.log.bak"} {
+		writeTestFile(t, dir, name, "line\n")
+	}
+	want := []string{
+		filepath.Join(dir, "app.log-20240501.gz"),
+		filepath.Join(dir, "app.log.2.gz"),
+		filepath.Join(dir, "app.log.1"),
+	}
+	if got := rotatedSiblings(filepath.Join(dir, "app.log")); !slices.Equal(got, want) {
+		t.Errorf("rotatedSiblings() = %v, want %v", got, want)
+	}
+}
+
+func TestGroupFamilies(t *testing.T) {
+	entries := []entry{
+		{Path: "/logs/app.log"},
+		{Path: "/logs/app.log.1"},
+		{Path: "/logs/app.log.2.gz"},
+		{Path: "/logs/orphan.log.1"},
+		{Path: "/logs/dir.1", IsDir: true},
+		{Path: "/logs/dir"},
+	}
+	got := groupFamilies(entries)
+	paths := func(es []entry) []string {
+		var ps []string
+		for _, e := range es {
+			ps = append(ps, e.Path)
+		}
+		return ps
+	}
+	if want := []string{"/logs/app.log", "/logs/orphan.log.1", "/logs/dir.1", "/logs/dir"}; !slices.Equal(paths(got), want) {
+		t.Fatalf("groupFamilies() = %v, want %v", paths(got), want)
+	}
+	if want := []string{"/logs/app.log.2.gz", "/logs/app.log.1"}; !slices.Equal(paths(got[0].Members), want) {
+		t.Errorf("members = %v, want %v", paths(got[0].Members), want)
+	}
+}
+
+func TestFamilyReader(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		writeTestFile(t, dir, "app.log.2.gz", "one\ntwo\n"),
+		writeTestFile(t, dir, "app.log.1", "three\nfour"),
+		writeTestFile(t, dir, "empty.log", ""),
+		writeTestFile(t, dir, "app.log", "five\n"),
+	}
+	fr := newFamilyReader(paths)
+	defer fr.Close()
+	got, err := io.ReadAll(fr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "one\ntwo\nthree\nfour\nfive\n"; string(got) != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,321 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxFeedBuffer is how much of the latest data of a followed file a feed
+	// keeps for its followers; followers further behind read the file themselves.
+	maxFeedBuffer = 256 * 1024
+	feedReadSize  = 32 * 1024
+)
+
+// feedGen is a generation of a followed path: the file it named from when the
+// feed opened it until it was rotated or truncated. The feed appends what it
+// reads to data, which holds bytes [start, end) of the file. Next is the
+// generation that replaced it, and event tells how.
+type feedGen struct {
+	f     *os.File
+	info  os.FileInfo
+	refs  int
+	start int64
+	end   int64
+	data  []byte
+	next  *feedGen
+	event followEvent
+}
+
+// feed reads a followed path once for all its followers: it waits for changes
+// through the watch hub (or polls), reads the appended data, notices rotation
+// and truncation, and wakes its followers, which copy the data from it.
+type feed struct {
+	path string
+	done chan struct{}
+	// pollMu serializes polls of the feed goroutine and of joining followers.
+	pollMu sync.Mutex
+
+	mu   sync.Mutex
+	cur  *feedGen
+	err  error
+	subs map[chan struct{}]struct{}
+}
+
+// feeds holds the feed of every followed path.
+var feeds = struct {
+	mu sync.Mutex
+	m  map[string]*feed
+}{m: make(map[string]*feed)}
+
+// joinFeed returns the feed of path, started on first use, and a channel that
+// receives a value whenever it read something new. The file is opened without
+// holding feeds.mu, so a slow filesystem does not block other paths.
+func joinFeed(path string) (*feed, chan struct{}) {
+	path = filepath.Clean(path)
+	feeds.mu.Lock()
+	fd := feeds.m[path]
+	if fd == nil {
+		feeds.mu.Unlock()
+		g := openGen(path, true)
+		feeds.mu.Lock()
+		if fd = feeds.m[path]; fd == nil {
+			fd = &feed{path: path, done: make(chan struct{}), subs: make(map[chan struct{}]struct{}), cur: g}
+			feeds.m[path] = fd
+			go fd.run()
+		} else if g != nil {
+			// Another follower started the feed meanwhile.
+			g.f.Close()
+		}
+	}
+	defer feeds.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	fd.mu.Lock()
+	fd.subs[ch] = struct{}{}
+	fd.mu.Unlock()
+	return fd, ch
+}
+
+// leave unsubscribes ch and stops the feed after its last follower left.
+func (fd *feed) leave(ch chan struct{}) {
+	feeds.mu.Lock()
+	defer feeds.mu.Unlock()
+	fd.mu.Lock()
+	delete(fd.subs, ch)
+	empty := len(fd.subs) == 0
+	fd.mu.Unlock()
+	if empty {
+		delete(feeds.m, fd.path)
+		close(fd.done)
+	}
+}
+
+// run polls the feed whenever the watch hub reports a change, or on an
+// interval, until the feed is stopped.
+func (fd *feed) run() {
+	changes, unsubscribe, watched := hub().subscribe(fd.path)
+	defer unsubscribe()
+	interval := followFilePollInterval
+	if watched {
+		// Still check now and then in case an event was missed.
+		interval = followWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// Changes made before the subscription were not reported.
+	fd.poll()
+	for {
+		select {
+		case <-fd.done:
+			fd.mu.Lock()
+			if fd.cur != nil {
+				fd.release(fd.cur)
+				fd.cur = nil
+			}
+			fd.mu.Unlock()
+			return
+		case <-changes:
+		case <-ticker.C:
+		}
+		fd.poll()
+	}
+}
+
+// open opens the path as the current generation.
+func (fd *feed) open() bool {
+	g := openGen(fd.path, false)
+	if g == nil {
+		return false
+	}
+	fd.mu.Lock()
+	fd.cur = g
+	fd.mu.Unlock()
+	return true
+}
+
+// openGen opens path as a new generation, or returns nil when it can not be
+// read. Followers already have the existing content of the first file, so its
+// data starts at its end.
+func openGen(path string, first bool) *feedGen {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil
+	}
+	g := &feedGen{f: f, info: info, refs: 1}
+	if first {
+		g.start, g.end = info.Size(), info.Size()
+	}
+	return g
+}
+
+// poll reads the data appended to the current file until its end, then checks
+// whether the path was rotated or the file truncated, in which case it goes on
+// with the new file, and wakes the followers. Only poll changes the
+// generations, so it reads them without holding mu.
+func (fd *feed) poll() {
+	fd.pollMu.Lock()
+	defer fd.pollMu.Unlock()
+	defer fd.wake()
+	if fd.current() == nil && !fd.open() {
+		return
+	}
+	for g := fd.current(); ; g = fd.current() {
+		if err := fd.readAll(g); err != nil {
+			fd.fail(err)
+			return
+		}
+		current, err := g.f.Stat()
+		if err != nil {
+			fd.fail(err)
+			return
+		}
+		// The path may be missing for a moment between a rename and the new file's creation.
+		var event followEvent
+		if info, lerr := os.Lstat(fd.path); lerr == nil && info.Mode().IsRegular() && !os.SameFile(info, current) {
+			event = followRotated
+		} else if current.Size() < g.end {
+			event = followTruncated
+		}
+		if event == followData || !fd.open() {
+			return
+		}
+		fd.mu.Lock()
+		g.next, g.event = fd.cur, event
+		fd.release(g)
+		fd.mu.Unlock()
+		log.Of(context.Background()).Named("Follow").Debug(
+			"followed file "+followEventName(event), zap.String("path", fd.path),
+		)
+	}
+}
+
+// current returns the current generation.
+func (fd *feed) current() *feedGen {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.cur
+}
+
+// readAll reads the data appended to the file of g until its end.
+func (fd *feed) readAll(g *feedGen) error {
+	buf := make([]byte, feedReadSize)
+	for {
+		n, err := g.f.ReadAt(buf, g.end)
+		if n > 0 {
+			fd.append(g, buf[:n])
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// append adds p to the data of g, dropping the oldest data past twice
+// maxFeedBuffer so the buffer is not copied on every read.
+func (fd *feed) append(g *feedGen, p []byte) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	g.data = append(g.data, p...)
+	g.end += int64(len(p))
+	if drop := len(g.data) - maxFeedBuffer; len(g.data) > 2*maxFeedBuffer {
+		g.data = append([]byte(nil), g.data[drop:]...)
+		g.start += int64(drop)
+	}
+}
+
+// fail makes followers that caught up return err.
+func (fd *feed) fail(err error) {
+	fd.mu.Lock()
+	fd.err = err
+	fd.mu.Unlock()
+}
+
+// wake notifies the followers without blocking; pending wake-ups coalesce.
+func (fd *feed) wake() {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	for ch := range fd.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// release drops a reference to g, closing its file after the last one. mu must be held.
+func (fd *feed) release(g *feedGen) {
+	g.refs--
+	if g.refs == 0 {
+		g.f.Close()
+	}
+}
+
+// attach makes fl read from the current generation when its file is the one
+// fl was opened on. The feed is polled first, so a rotation that fl saw already
+// is not mistaken for an older file.
+func (fd *feed) attach(fl *follower) {
+	fd.poll()
+	info, err := fl.f.Stat()
+	if err != nil {
+		return
+	}
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if g := fd.cur; g != nil && os.SameFile(g.info, info) {
+		g.refs++
+		fl.gen = g
+	}
+}
+
+// read copies data of fl's generation at its offset into buf, reading the file
+// when fl fell behind the buffered data. Past the end of a replaced generation
+// it moves fl to the next one and reports the event. Otherwise it returns io.EOF,
+// or the error that stopped the feed.
+func (fd *feed) read(fl *follower, buf []byte) (int, followEvent, error) {
+	fd.mu.Lock()
+	g := fl.gen
+	if fl.offset >= g.start && fl.offset < g.end {
+		n := copy(buf, g.data[fl.offset-g.start:])
+		fd.mu.Unlock()
+		fl.offset += int64(n)
+		return n, followData, nil
+	}
+	if fl.offset < g.start {
+		size := min(int64(len(buf)), g.end-fl.offset)
+		fd.mu.Unlock()
+		n, err := g.f.ReadAt(buf[:size], fl.offset)
+		fl.offset += int64(n)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, followData, err
+		}
+		// The file was truncated since; continue once the feed noticed.
+		fd.mu.Lock()
+	}
+	defer fd.mu.Unlock()
+	if g.next == nil {
+		if fd.err != nil {
+			return 0, followData, fd.err
+		}
+		return 0, followData, io.EOF
+	}
+	g.next.refs++
+	fd.release(g)
+	fl.gen, fl.offset = g.next, 0
+	return 0, g.event, nil
+}
@@ -0,0 +1,181 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// followTest follows path from offset, as a follow request would, and sends
+// every line and event it reads to the returned channel until the test ends.
+// Events are sent as their marker line.
+func followTest(t *testing.T, path string, offset int64) <-chan string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	fl, err := newFollower(path, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string, 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = followLines(ctx, fl, func(l followedLine) error {
+			text := string(l.Text)
+			switch l.Event {
+			case followRotated:
+				text = rotationMarker
+			case followTruncated:
+				text = truncationMarker
+			}
+			select {
+			case lines <- text:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, func() error { return nil })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		fl.Close()
+		f.Close()
+	})
+	return lines
+}
+
+// feedOf returns the running feed of path, if any.
+func feedOf(path string) *feed {
+	feeds.mu.Lock()
+	defer feeds.mu.Unlock()
+	return feeds.m[filepath.Clean(path)]
+}
+
+func TestFeedFollowers(t *testing.T) {
+	p := writeTestFile(t, t.TempDir(), "app.log", "old\n")
+	first := followTest(t, p, 4)
+	second := followTest(t, p, 4)
+	if feedOf(p) == nil {
+		t.Fatal("no feed for the followed path")
+	}
+	appendTestFile(t, p, "one\ntw")
+	expectLines(t, first, "one")
+	appendTestFile(t, p, "o\nthree\n")
+	expectLines(t, first, "two", "three")
+	expectLines(t, second, "one", "two", "three")
+}
+
+func TestFeedRotation(t *testing.T) {
+	dir := t.TempDir()
+	p := writeTestFile(t, dir, "app.log", "")
+	lines := followTest(t, p, 0)
+	appendTestFile(t, p, "before\npartial")
+	expectLines(t, lines, "before")
+	if err := os.Rename(p, filepath.Join(dir, "app.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "app.log", "after\n")
+	// The partial line of the rotated file is sent as it is.
+	expectLines(t, lines, "partial", rotationMarker, "after")
+	appendTestFile(t, p, "more\n")
+	expectLines(t, lines, "more")
+}
+
+func TestFeedTruncation(t *testing.T) {
+	p := writeTestFile(t, t.TempDir(), "app.log", "")
+	lines := followTest(t, p, 0)
+	appendTestFile(t, p, "one\ntwo\n")
+	expectLines(t, lines, "one", "two")
+	if err := os.Truncate(p, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendTestFile(t, p, "new\n")
+	expectLines(t, lines, truncationMarker, "new")
+}
+
+func TestFeedLateJoiner(t *testing.T) {
+	p := writeTestFile(t, t.TempDir(), "app.log", "")
+	early := followTest(t, p, 0)
+	var content strings.Builder
+	var want []string
+	for i := 0; content.Len() <= 3*maxFeedBuffer; i++ {
+		line := strconv.Itoa(i) + strings.Repeat("x", 100)
+		content.WriteString(line + "\n")
+		want = append(want, line)
+	}
+	appendTestFile(t, p, content.String())
+	expectLines(t, early, want...)
+
+	fd := feedOf(p)
+	fd.mu.Lock()
+	start := fd.cur.start
+	fd.mu.Unlock()
+	if start == 0 {
+		t.Fatal("the feed kept all data, want the oldest dropped")
+	}
+	// The late joiner reads what the feed dropped from the file.
+	late := followTest(t, p, 0)
+	expectLines(t, late, want...)
+	appendTestFile(t, p, "last\n")
+	expectLines(t, late, "last")
+	expectLines(t, early, "last")
+}
+
+func TestFeedLastFollowerLeaves(t *testing.T) {
+	p := writeTestFile(t, t.TempDir(), "app.log", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			appendTestFile(t, p, "line\n")
+		}
+	}()
+	for range 50 {
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fl, err := newFollower(p, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, readChunkSize)
+		_, _, _ = fl.read(buf)
+		fl.Close()
+		f.Close()
+	}
+	cancel()
+	wg.Wait()
+	if fd := feedOf(p); fd != nil {
+		t.Errorf("feed still running after its last follower left")
+	}
+}
+
+func TestFeedDroppedData(t *testing.T) {
+	fd := &feed{}
+	g := &feedGen{}
+	chunk := bytes.Repeat([]byte("x"), maxFeedBuffer)
+	for range 3 {
+		fd.append(g, chunk)
+	}
+	if g.end != 3*maxFeedBuffer || int64(len(g.data)) != g.end-g.start || len(g.data) > 2*maxFeedBuffer {
+		t.Errorf("feed holds [%d, %d) in %d bytes, want at most %d bytes ending at %d",
+			g.start, g.end, len(g.data), 2*maxFeedBuffer, 3*maxFeedBuffer)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package filesystem
+
+import "os"
+
+// fileIdentity is empty where files have no device and inode numbers, so
+// resuming streams can not tell a rotated file from the one that was followed.
+func fileIdentity(os.FileInfo) string {
+	return ""
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileIdentity identifies the file of info by its device and inode, so that a
+// file replaced by rotation is told apart from the one a client followed.
+func fileIdentity(info os.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x", st.Dev, st.Ino)
+}
@@ -0,0 +1,264 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+)
+
+const maxFollowLineLength = 1024 * 1024
+
+// In-band markers written to follow streams when the followed file changes identity.
+const (
+	rotationMarker   = "==> timber: file rotated <=="
+	truncationMarker = "==> timber: file truncated <=="
+)
+
+// followEvent is what a follower read.
+type followEvent int
+
+const (
+	followData followEvent = iota
+	followRotated
+	followTruncated
+)
+
+// follower reads a followed file like `tail -F`: once it reached the end of the
+// file it notices when the path was replaced by a new file (rotation) or the file
+// shrank (truncation), and continues at the start of the new content.
+// The followers of a path share its feed, which reads new data once for all of
+// them; a follower only reads the file itself while it is behind the feed, or
+// until it reached the end of a file that was rotated before it joined.
+type follower struct {
+	path   string
+	feed   *feed
+	gen    *feedGen
+	f      *os.File
+	info   os.FileInfo
+	offset int64
+	wakes  chan struct{}
+}
+
+// newFollower follows f, opened from path, from its current offset.
+func newFollower(path string, f *os.File) (*follower, error) {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fl := &follower{path: path, f: f, info: info, offset: offset}
+	fl.feed, fl.wakes = joinFeed(path)
+	fl.feed.attach(fl)
+	return fl, nil
+}
+
+// wait blocks until the feed read something new or ctx is done.
+func (fl *follower) wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-fl.wakes:
+	}
+	return nil
+}
+
+// read reads new data into buf. At the end of the file it reports rotation
+// and truncation as events without data; otherwise it returns io.EOF.
+func (fl *follower) read(buf []byte) (int, followEvent, error) {
+	if fl.gen != nil {
+		return fl.feed.read(fl, buf)
+	}
+	// f is not the file of the feed: read it to its end, then move to the feed.
+	n, err := fl.f.ReadAt(buf, fl.offset)
+	fl.offset += int64(n)
+	if n > 0 || !errors.Is(err, io.EOF) {
+		return n, followData, err
+	}
+	current, err := fl.f.Stat()
+	if err != nil {
+		return 0, followData, err
+	}
+	fd := fl.feed
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	g := fd.cur
+	if g == nil {
+		// The path is missing; wait for it to come back.
+		return 0, followData, io.EOF
+	}
+	g.refs++
+	fl.gen = g
+	if os.SameFile(g.info, current) {
+		return 0, followData, nil
+	}
+	fl.offset = 0
+	return 0, followRotated, nil
+}
+
+// file returns the identity of the file fl reads.
+func (fl *follower) file() string {
+	if fl.gen != nil {
+		return fileIdentity(fl.gen.info)
+	}
+	return fileIdentity(fl.info)
+}
+
+// Close leaves the feed.
+func (fl *follower) Close() {
+	fd := fl.feed
+	fd.mu.Lock()
+	if fl.gen != nil {
+		fd.release(fl.gen)
+		fl.gen = nil
+	}
+	fd.mu.Unlock()
+	fd.leave(fl.wakes)
+}
+
+// followedLine is a complete line of a followed file without its line ending,
+// or a rotation or truncation event without text. End is the offset right after
+// the line, which is 0 for events as the new content starts there, in the file
+// identified by File.
+type followedLine struct {
+	Event followEvent
+	End   int64
+	File  string
+	Text  []byte
+}
+
+// followLines reads fl line by line and calls emit for every complete line and
+// event, and idle once it caught up, before waiting for changes. Text is only
+// valid during the call to emit. It returns when ctx is done or emit, idle or
+// reading fails.
+func followLines(ctx context.Context, fl *follower, emit func(followedLine) error, idle func() error) error {
+	logger := log.Of(ctx)
+	lines := &lineBuffer{offset: fl.offset, file: fl.file()}
+	buf := make([]byte, readChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, event, err := fl.read(buf)
+		if event != followData {
+			logger.Info("followed file "+followEventName(event), zap.String("path", fl.path))
+			if eerr := lines.reset(event, fl.file(), emit); eerr != nil {
+				return eerr
+			}
+		}
+		if eerr := lines.write(buf[:n], emit); eerr != nil {
+			return eerr
+		}
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		if err = idle(); err != nil {
+			return err
+		}
+		if err = fl.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// lineBuffer splits followed data into lines, holding back a partial line until
+// it is completed. Lines longer than maxFollowLineLength are truncated.
+type lineBuffer struct {
+	offset  int64
+	file    string
+	pending []byte
+}
+
+// write emits the lines completed by p.
+func (b *lineBuffer) write(p []byte, emit func(followedLine) error) error {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		chunk := p
+		if i >= 0 {
+			chunk = p[:i+1]
+		}
+		p = p[len(chunk):]
+		b.offset += int64(len(chunk))
+		if room := maxFollowLineLength - len(b.pending); room > 0 {
+			b.pending = append(b.pending, chunk[:min(len(chunk), room)]...)
+		}
+		if i < 0 {
+			return nil
+		}
+		text := bytes.TrimSuffix(bytes.TrimSuffix(b.pending, []byte("\n")), []byte("\r"))
+		if err := emit(followedLine{End: b.offset, File: b.file, Text: text}); err != nil {
+			return err
+		}
+		b.pending = b.pending[:0]
+	}
+	return nil
+}
+
+// reset emits the partial line of the replaced content as is, then event, and
+// starts over at offset 0 of file.
+func (b *lineBuffer) reset(event followEvent, file string, emit func(followedLine) error) error {
+	if len(b.pending) > 0 {
+		if err := emit(followedLine{End: b.offset, File: b.file, Text: b.pending}); err != nil {
+			return err
+		}
+		b.pending = b.pending[:0]
+	}
+	b.offset, b.file = 0, file
+	return emit(followedLine{Event: event, File: file})
+}
+
+// followEventName returns the name of a rotation or truncation event.
+func followEventName(event followEvent) string {
+	if event == followRotated {
+		return "rotated"
+	}
+	return "truncated"
+}
+
+// lastLinesStart returns the offset of the last n complete lines of f.
+func lastLinesStart(f *os.File, n int) (int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	start, err := lineStartBefore(f, stat.Size())
+	for i := 0; err == nil && i < n && start > 0; i++ {
+		start, err = lineStartBefore(f, start-1)
+	}
+	return start, err
+}
+
+var errNotLineStart = errors.New("offset is not at the start of a line")
+
+// resumeOffset returns offset to resume following f at, unless f shrank below it
+// since, in which case it reports the truncation and starts over. An offset that
+// does not follow a line ending is rejected with errNotLineStart.
+func resumeOffset(f *os.File, offset int64) (int64, bool, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	if offset > stat.Size() {
+		return 0, true, nil
+	}
+	if offset > 0 {
+		var last [1]byte
+		if _, err = f.ReadAt(last[:], offset-1); err != nil {
+			return 0, false, err
+		}
+		if last[0] != '\n' {
+			return 0, false, errNotLineStart
+		}
+	}
+	return offset, false, nil
+}
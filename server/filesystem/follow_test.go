@@ -0,0 +1,178 @@
+package filesystem
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fmotalleb/timber/server/helper"
+)
+
+const followTestTimeout = 5 * time.Second
+
+// expectLines fails the test unless lines receives want, in order.
+func expectLines(t *testing.T, lines <-chan string, want ...string) {
+	t.Helper()
+	timeout := time.After(followTestTimeout)
+	for i, w := range want {
+		select {
+		case got := <-lines:
+			if got != w {
+				t.Fatalf("line %d = %q, want %q", i, got, w)
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for line %d, %q", i, w)
+		}
+	}
+}
+
+// appendTestFile appends content to the file at path.
+func appendTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLineBuffer(t *testing.T) {
+	type step struct {
+		data  string
+		event followEvent
+		file  string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+		want  []followedLine
+	}{
+		{
+			"complete and partial lines",
+			[]step{{data: "one\ntw"}, {data: "o\r\nthree"}},
+			[]followedLine{{End: 4, File: "a", Text: []byte("one")}, {End: 9, File: "a", Text: []byte("two")}},
+		},
+		{
+			"partial line before a rotation",
+			[]step{{data: "one\npart"}, {event: followRotated, file: "b"}, {data: "new\n"}},
+			[]followedLine{
+				{End: 4, File: "a", Text: []byte("one")},
+				{End: 8, File: "a", Text: []byte("part")},
+				{Event: followRotated, File: "b"},
+				{End: 4, File: "b", Text: []byte("new")},
+			},
+		},
+		{
+			"truncation without a partial line",
+			[]step{{data: "one\n"}, {event: followTruncated, file: "a"}, {data: "x\n"}},
+			[]followedLine{
+				{End: 4, File: "a", Text: []byte("one")},
+				{Event: followTruncated, File: "a"},
+				{End: 2, File: "a", Text: []byte("x")},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []followedLine
+			emit := func(l followedLine) error {
+				l.Text = slices.Clone(l.Text)
+				got = append(got, l)
+				return nil
+			}
+			b := &lineBuffer{file: "a"}
+			for _, s := range tt.steps {
+				if s.event != followData {
+					if err := b.reset(s.event, s.file, emit); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := b.write([]byte(s.data), emit); err != nil {
+					t.Fatal(err)
+				}
+			}
+			equal := slices.EqualFunc(got, tt.want, func(a, b followedLine) bool {
+				return a.Event == b.Event && a.End == b.End && a.File == b.File && string(a.Text) == string(b.Text)
+			})
+			if !equal {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineBufferLongLine(t *testing.T) {
+	var got []byte
+	b := &lineBuffer{}
+	long := make([]byte, maxFollowLineLength+10)
+	for i := range long {
+		long[i] = 'x'
+	}
+	err := b.write(append(long, '\n'), func(l followedLine) error {
+		got = slices.Clone(l.Text)
+		return nil
+	})
+	if err != nil || len(got) != maxFollowLineLength || b.offset != int64(len(long)+1) {
+		t.Errorf("long line = %d bytes at offset %d, %v, want %d bytes at offset %d",
+			len(got), b.offset, err, maxFollowLineLength, len(long)+1)
+	}
+}
+
+// followTail follows path through Tail and sends every line of the response
+// to the returned channel.
+func followTail(t *testing.T, path string) <-chan string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Tail(w, helper.WithPath(r, path))
+	}))
+	t.Cleanup(srv.Close)
+	resp, err := http.Get(srv.URL + "/?follow=true&lines=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	lines := make(chan string, 1024)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return lines
+}
+
+func TestFollowRotation(t *testing.T) {
+	dir := t.TempDir()
+	p := writeTestFile(t, dir, "app.log", "old\n")
+	lines := followTail(t, p)
+	expectLines(t, lines, "old")
+	appendTestFile(t, p, "before\npartial")
+	expectLines(t, lines, "before")
+	if err := os.Rename(p, filepath.Join(dir, "app.log.1")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "app.log", "after\n")
+	// The marker starts on a line of its own after the partial line.
+	expectLines(t, lines, "partial", rotationMarker, "after")
+}
+
+func TestFollowTruncation(t *testing.T) {
+	p := writeTestFile(t, t.TempDir(), "app.log", "old\n")
+	lines := followTail(t, p)
+	expectLines(t, lines, "old")
+	appendTestFile(t, p, "one\n")
+	expectLines(t, lines, "one")
+	if err := os.Truncate(p, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendTestFile(t, p, "new\n")
+	expectLines(t, lines, truncationMarker, "new")
+}
@@ -0,0 +1,258 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/server/auth"
+	"github.com/fmotalleb/timber/server/helper"
+)
+
+const (
+	maxGrepContext    = 1000
+	maxGrepLineLength = 1024 * 1024
+)
+
+// grepOptions are the query parameters of a search.
+type grepOptions struct {
+	Pattern     *regexp.Regexp
+	Literal     []byte
+	Invert      bool
+	Before      int
+	After       int
+	MaxCount    int
+	LineNumbers bool
+}
+
+// grepLine is a line found by a search, either a match or a context line.
+type grepLine struct {
+	Number int64
+	Text   []byte
+	Match  bool
+}
+
+// parseGrepOptions reads the search options of a request.
+// `pattern` is a literal string, or an RE2 regular expression with `regex=true`.
+func parseGrepOptions(r *http.Request) (grepOptions, error) {
+	q := r.URL.Query()
+	pattern := q.Get("pattern")
+	if pattern == "" {
+		return grepOptions{}, errors.New("missing `pattern` query parameter")
+	}
+	opts := grepOptions{
+		Invert:      helper.GetFlag(r, "invert"),
+		LineNumbers: helper.GetFlag(r, "line_numbers"),
+	}
+	regex, ignoreCase := helper.GetFlag(r, "regex"), helper.GetFlag(r, "ignore_case")
+	if regex || ignoreCase {
+		if !regex {
+			pattern = regexp.QuoteMeta(pattern)
+		}
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return grepOptions{}, errors.New("invalid `pattern`: " + err.Error())
+		}
+		opts.Pattern = re
+	} else {
+		opts.Literal = []byte(pattern)
+	}
+
+	ctxLines, err := getIntParam(r, "context", 0, maxGrepContext)
+	if err != nil {
+		return grepOptions{}, err
+	}
+	if opts.Before, err = getIntParam(r, "before", ctxLines, maxGrepContext); err != nil {
+		return grepOptions{}, err
+	}
+	if opts.After, err = getIntParam(r, "after", ctxLines, maxGrepContext); err != nil {
+		return grepOptions{}, err
+	}
+	if opts.MaxCount, err = getIntParam(r, "max_count", 0, -1); err != nil {
+		return grepOptions{}, err
+	}
+	return opts, nil
+}
+
+// getIntParam returns the non-negative integer query parameter name, or def when missing.
+// A non-negative limit caps the value.
+func getIntParam(r *http.Request, name string, def, limit int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || (limit >= 0 && n > limit) {
+		return 0, errors.New("invalid `" + name + "` query parameter")
+	}
+	return n, nil
+}
+
+// matches reports whether the line is a match, honoring Invert.
+func (o grepOptions) matches(line []byte) bool {
+	if o.Pattern == nil {
+		return bytes.Contains(line, o.Literal) != o.Invert
+	}
+	return o.Pattern.Match(line) != o.Invert
+}
+
+// grepReader searches r and calls emit for every match and context line, in order,
+// until emit returns false, MaxCount matches were found or ctx is done.
+func grepReader(ctx context.Context, r io.Reader, opts grepOptions, emit func(grepLine) bool) error {
+	reader := bufio.NewReaderSize(r, readChunkSize)
+	var (
+		before    []grepLine
+		afterLeft int
+		matches   int
+		number    int64
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		text, err := readLine(reader)
+		if len(text) == 0 && err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		number++
+
+		done := opts.MaxCount > 0 && matches >= opts.MaxCount
+		switch {
+		case !done && opts.matches(text):
+			for _, l := range before {
+				if !emit(l) {
+					return nil
+				}
+			}
+			before = before[:0]
+			matches++
+			afterLeft = opts.After
+			if !emit(grepLine{Number: number, Text: text, Match: true}) {
+				return nil
+			}
+		case afterLeft > 0:
+			afterLeft--
+			if !emit(grepLine{Number: number, Text: text}) {
+				return nil
+			}
+		case done:
+			return nil
+		case opts.Before > 0:
+			if len(before) == opts.Before {
+				before = append(before[:0], before[1:]...)
+			}
+			before = append(before, grepLine{Number: number, Text: text})
+		}
+	}
+}
+
+// readLine reads the next line without its line ending. Lines longer than
+// maxGrepLineLength are truncated.
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line) < maxGrepLineLength {
+			line = append(line, chunk[:min(len(chunk), maxGrepLineLength-len(line))]...)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			line = line[:len(line)-1]
+			if len(line) > 0 && line[len(line)-1] == '\r' {
+				line = line[:len(line)-1]
+			}
+		}
+		return line, err
+	}
+}
+
+// Grep streams the lines of a file matching `pattern`, grep style, decompressing compressed files.
+// Match lines are prefixed with `<n>:` and context lines with `<n>-` when
+// `line_numbers` is set, and non-adjacent groups of context are separated by `--`.
+// With `family=true` the log and its rotated files are searched as one, oldest first.
+func Grep(w http.ResponseWriter, r *http.Request) {
+	logger := log.Of(r.Context())
+	filePath, ok := helper.GetPath(r)
+	if !ok {
+		http.Error(w, "missing `path` query parameter", http.StatusBadRequest)
+		return
+	}
+	opts, err := parseGrepOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		src io.ReadCloser
+		c   *compression
+	)
+	if members := familyMembers(r, auth.OpGrep); members != nil {
+		src = newFamilyReader(members)
+	} else {
+		f, openErr := os.Open(filePath)
+		if openErr != nil {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		if src, c, err = textReader(f); err != nil {
+			logger.Error("failed to read file", zap.Error(err))
+			http.Error(w, "failed to read file", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	defer src.Close()
+
+	setCompressionHeader(w, c)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	out := newFlushWriter(w)
+	withContext := opts.Before > 0 || opts.After > 0
+	var last int64
+	var buf []byte
+	err = grepReader(r.Context(), src, opts, func(l grepLine) bool {
+		buf = buf[:0]
+		if withContext && last > 0 && l.Number > last+1 {
+			buf = append(buf, "--\n"...)
+		}
+		last = l.Number
+		if opts.LineNumbers {
+			buf = strconv.AppendInt(buf, l.Number, 10)
+			if l.Match {
+				buf = append(buf, ':')
+			} else {
+				buf = append(buf, '-')
+			}
+		}
+		buf = append(append(buf, l.Text...), '\n')
+		_, werr := out.Write(buf)
+		return werr == nil
+	})
+	out.Close()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Error("failed to search file", zap.Error(err))
+	}
+	if out.Err() != nil {
+		logger.Warn("failed to write response", zap.Error(out.Err()))
+	}
+}
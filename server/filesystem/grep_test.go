@@ -0,0 +1,113 @@
+package filesystem
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	const content = "alpha\nbeta\ngamma match\ndelta\nepsilon\nzeta\neta match\ntheta\niota match\nkappa\n"
+	tests := []struct {
+		name  string
+		query url.Values
+		want  string
+	}{
+		{
+			"literal",
+			url.Values{"pattern": {"match"}},
+			"gamma match\neta match\niota match\n",
+		},
+		{
+			"line numbers",
+			url.Values{"pattern": {"match"}, "line_numbers": {"true"}},
+			"3:gamma match\n7:eta match\n9:iota match\n",
+		},
+		{
+			"context",
+			url.Values{"pattern": {"match"}, "line_numbers": {"true"}, "context": {"1"}},
+			"2-beta\n3:gamma match\n4-delta\n--\n6-zeta\n7:eta match\n8-theta\n9:iota match\n10-kappa\n",
+		},
+		{
+			"before",
+			url.Values{"pattern": {"match"}, "line_numbers": {"true"}, "before": {"2"}},
+			"1-alpha\n2-beta\n3:gamma match\n--\n5-epsilon\n6-zeta\n7:eta match\n8-theta\n9:iota match\n",
+		},
+		{
+			"context without line numbers",
+			url.Values{"pattern": {"gamma"}, "after": {"1"}},
+			"gamma match\ndelta\n",
+		},
+		{
+			"max count",
+			url.Values{"pattern": {"match"}, "line_numbers": {"true"}, "max_count": {"1"}},
+			"3:gamma match\n",
+		},
+		{
+			"max count keeps the context of the last match",
+			url.Values{"pattern": {"match"}, "line_numbers": {"true"}, "after": {"1"}, "max_count": {"2"}},
+			"3:gamma match\n4-delta\n--\n7:eta match\n8-theta\n",
+		},
+		{
+			"max count zero is unlimited",
+			url.Values{"pattern": {"match"}, "max_count": {"0"}},
+			"gamma match\neta match\niota match\n",
+		},
+		{
+			"invert",
+			url.Values{"pattern": {"a"}, "invert": {"true"}, "line_numbers": {"true"}},
+			"5:epsilon\n",
+		},
+		{
+			"invert with max count",
+			url.Values{"pattern": {"match"}, "invert": {"true"}, "max_count": {"2"}},
+			"alpha\nbeta\n",
+		},
+		{
+			"ignore case",
+			url.Values{"pattern": {"MATCH"}, "ignore_case": {"true"}, "max_count": {"1"}},
+			"gamma match\n",
+		},
+		{
+			"literal metacharacters",
+			url.Values{"pattern": {"a.p"}},
+			"",
+		},
+		{
+			"regex",
+			url.Values{"pattern": {"^(alpha|kappa)$"}, "regex": {"true"}, "line_numbers": {"true"}},
+			"1:alpha\n10:kappa\n",
+		},
+	}
+	dir := t.TempDir()
+	for _, file := range []string{"app.log", "app.log.gz"} {
+		p := writeTestFile(t, dir, file, content)
+		for _, tt := range tests {
+			t.Run(file+"/"+tt.name, func(t *testing.T) {
+				w := serveFile(Grep, p, tt.query.Encode())
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+				}
+				if got := w.Body.String(); got != tt.want {
+					t.Errorf("body = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestGrepInvalid(t *testing.T) {
+	p := writeTestFile(t, t.TempDir(), "app.log", "alpha\n")
+	tests := []url.Values{
+		{},
+		{"pattern": {"("}, "regex": {"true"}},
+		{"pattern": {"a"}, "context": {"-1"}},
+		{"pattern": {"a"}, "before": {"1001"}},
+		{"pattern": {"a"}, "max_count": {"x"}},
+	}
+	for _, query := range tests {
+		if w := serveFile(Grep, p, query.Encode()); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query.Encode(), w.Code, http.StatusBadRequest)
+		}
+	}
+}
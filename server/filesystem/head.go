@@ -9,10 +9,12 @@ import (
 	"github.com/fmotalleb/go-tools/log"
 	"go.uber.org/zap"
 
+	"github.com/fmotalleb/timber/server/auth"
 	"github.com/fmotalleb/timber/server/helper"
 )
 
-// Head returns the first n lines of a file.
+// Head returns the first n lines of a file, decompressing compressed files.
+// With `family=true` the log and its rotated files are read as one, oldest first.
 func Head(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := log.Of(ctx)
@@ -22,10 +24,6 @@ func Head(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "missing `path` query parameter", http.StatusBadRequest)
 		return
 	}
-	if containsDotDot(filePath) {
-		http.Error(w, "invalid path", http.StatusBadRequest)
-		return
-	}
 
 	lines := getLinesParam(r, defaultLineCount)
 	if lines <= 0 {
@@ -52,10 +50,25 @@ func Head(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	var src io.ReadCloser
+	var c *compression
+	if members := familyMembers(r, auth.OpHead); members != nil {
+		src = newFamilyReader(members)
+	} else {
+		src, c, err = textReader(f)
+	}
+	if err != nil {
+		logger.Error("failed to read file", zap.Error(err))
+		http.Error(w, "failed to read file", http.StatusUnprocessableEntity)
+		return
+	}
+	defer src.Close()
+
+	setCompressionHeader(w, c)
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 
-	reader := bufio.NewReader(f)
+	reader := bufio.NewReader(src)
 
 	for i := 0; i < lines; i++ {
 		select {
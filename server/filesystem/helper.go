@@ -7,7 +7,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/fmotalleb/go-tools/log"
@@ -17,42 +17,25 @@ import (
 const (
 	readChunkSize          = 4096
 	followFilePollInterval = 200 * time.Millisecond
+	followWatchInterval    = 5 * time.Second
+	streamFlushInterval    = 200 * time.Millisecond
 	defaultLineCount       = 10
+	maxLineCount           = 10000
 )
 
+// getLinesParam returns the `lines` query parameter, or def when it is missing
+// or invalid. It is capped at maxLineCount.
 func getLinesParam(r *http.Request, def int) int {
 	v := r.URL.Query().Get("lines")
 	if v == "" {
 		return def
 	}
 	if n, err := strconv.Atoi(v); err == nil && n > 0 {
-		return n
+		return min(n, maxLineCount)
 	}
 	return def
 }
 
-func containsDotDot(v string) bool {
-	if !strings.Contains(v, "..") {
-		return false
-	}
-	for _, ent := range strings.Split(v, "/") {
-		if ent == ".." {
-			return true
-		}
-	}
-	for _, ent := range strings.Split(v, `\`) {
-		if ent == ".." {
-			return true
-		}
-	}
-	return false
-}
-
-func getFollowParam(r *http.Request) bool {
-	v := strings.ToLower(r.URL.Query().Get("follow"))
-	return v == "1" || v == "true" || v == "yes"
-}
-
 func tailLines(f *os.File, n int) ([]string, error) {
 	const blockSize = 4096
 
@@ -120,7 +103,10 @@ func reverse(s []string) []string {
 	return s
 }
 
-func followFile(w http.ResponseWriter, r *http.Request, f *os.File) {
+// followFile streams data appended to f, opened from path, continuing with the
+// new file when it is rotated or truncated and writing an in-band marker line.
+// New data is read by the feed of the path, shared with its other followers.
+func followFile(w http.ResponseWriter, r *http.Request, f *os.File, path string) {
 	h := w.Header()
 	h.Set("Content-Type", "application/octet-stream")
 	h.Set("Cache-Control", "no-cache")
@@ -134,31 +120,129 @@ func followFile(w http.ResponseWriter, r *http.Request, f *os.File) {
 	}
 	flusher.Flush()
 
-	reader := bufio.NewReader(f)
+	logger := log.Of(r.Context())
+	fl, err := newFollower(path, f)
+	if err != nil {
+		logger.Error("failed to follow file", zap.Error(err))
+		return
+	}
+	defer fl.Close()
+
 	ctx := r.Context()
 	buf := make([]byte, readChunkSize) // read chunks of 4KB
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
+	lineStart := true
+
+	for ctx.Err() == nil {
+		n, event, err := fl.read(buf)
+		var out []byte
+		switch event {
+		case followRotated:
+			out = markerLine(rotationMarker, lineStart)
+			logger.Info("followed file rotated", zap.String("path", path))
+		case followTruncated:
+			out = markerLine(truncationMarker, lineStart)
+			logger.Info("followed file truncated", zap.String("path", path))
 		default:
+			out = buf[:n]
 		}
-
-		n, err := reader.Read(buf)
-		if n > 0 {
-			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
-				log.Of(r.Context()).Error("failed to write response", zap.Error(writeErr))
+		if len(out) > 0 {
+			if _, writeErr := w.Write(out); writeErr != nil {
+				logger.Error("failed to write response", zap.Error(writeErr))
+				return
 			}
+			lineStart = out[len(out)-1] == '\n'
 			flusher.Flush()
 		}
 
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				time.Sleep(followFilePollInterval)
+			if errors.Is(err, io.EOF) && fl.wait(ctx) == nil {
 				continue
 			}
 			return
 		}
 	}
 }
+
+// markerLine returns marker as a line of its own.
+func markerLine(marker string, lineStart bool) []byte {
+	if lineStart {
+		return []byte(marker + "\n")
+	}
+	return []byte("\n" + marker + "\n")
+}
+
+var errFlushWriterClosed = errors.New("write after close")
+
+// flushWriter buffers a streamed response and flushes pending data within
+// streamFlushInterval, remembering the first write error. It is safe for
+// concurrent use.
+type flushWriter struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	flusher http.Flusher
+	timer   *time.Timer
+	closed  bool
+	err     error
+}
+
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	f, _ := w.(http.Flusher)
+	return &flushWriter{w: bufio.NewWriter(w), flusher: f}
+}
+
+// Write buffers p and schedules a flush. It returns the first write error.
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, errFlushWriterClosed
+	}
+	if f.err != nil {
+		return 0, f.err
+	}
+	var n int
+	n, f.err = f.w.Write(p)
+	if f.timer == nil {
+		f.timer = time.AfterFunc(streamFlushInterval, f.Flush)
+	}
+	return n, f.err
+}
+
+// Flush sends the buffered data to the client.
+func (f *flushWriter) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.flush()
+	}
+}
+
+func (f *flushWriter) flush() {
+	f.timer = nil
+	if f.err != nil {
+		return
+	}
+	f.err = f.w.Flush()
+	if f.err == nil && f.flusher != nil {
+		f.flusher.Flush()
+	}
+}
+
+// Close flushes the remaining data and stops scheduled flushes.
+// The writer must not be used after the handler returns.
+func (f *flushWriter) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	f.flush()
+	f.closed = true
+}
+
+// Err returns the first write error.
+func (f *flushWriter) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
@@ -1,12 +1,14 @@
 package filesystem
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/fmotalleb/go-tools/log"
 	"go.uber.org/zap"
 
@@ -15,11 +17,13 @@ import (
 )
 
 type Node struct {
-	Name     string  `json:"name"`
-	Path     string  `json:"path,omitempty"`
-	Type     string  `json:"type"`
-	Children []*Node `json:"children,omitempty"`
-	Size     int64   `json:"size"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path,omitempty"`
+	Type     string    `json:"type"`
+	Children []*Node   `json:"children,omitempty"`
+	Size     int64     `json:"size"`
+	Ops      []auth.Op `json:"ops,omitempty"`
+	Members  []*Node   `json:"members,omitempty"`
 }
 
 func (n *Node) getSize() int64 {
@@ -60,13 +64,11 @@ func (n *Node) findOrCreateChild(name string, nodeType string, size int64) *Node
 	return newNode
 }
 
-func insertPath(root *Node, path string, isDir bool) {
+func insertPath(root *Node, e entry) {
+	path := e.Path
 	parts := strings.Split(path, string(os.PathSeparator))
 	currentNode := root
-	size := int64(0)
-	if stat, err := os.Stat(path); err == nil {
-		size = stat.Size()
-	}
+	size := fileSize(path)
 	for i, part := range parts {
 		if part == "" {
 			continue
@@ -74,7 +76,7 @@ func insertPath(root *Node, path string, isDir bool) {
 		nodeType := "dir"
 		// The last part of the path determines the type
 		fSize := int64(0)
-		if i == len(parts)-1 && !isDir {
+		if i == len(parts)-1 && !e.IsDir {
 			nodeType = "file"
 			fSize = size
 		}
@@ -82,11 +84,30 @@ func insertPath(root *Node, path string, isDir bool) {
 		// Set the full path only for the final node in the path
 		if i == len(parts)-1 {
 			currentNode.Path = path
+			currentNode.Ops = e.Ops
+			for _, m := range e.Members {
+				currentNode.Members = append(currentNode.Members, &Node{
+					Name: filepath.Base(m.Path),
+					Path: m.Path,
+					Type: "file",
+					Size: fileSize(m.Path),
+					Ops:  m.Ops,
+				})
+			}
 		}
 	}
 }
 
+func fileSize(path string) int64 {
+	if stat, err := os.Stat(path); err == nil {
+		return stat.Size()
+	}
+	return 0
+}
+
 // Ls returns a list of files that the user has access to.
+// Rotated files are listed as Members of their log, oldest first, with their
+// own operations.
 func Ls(w http.ResponseWriter, r *http.Request) {
 	access, ok := auth.AccessFromContext(r.Context())
 	if !ok {
@@ -96,10 +117,33 @@ func Ls(w http.ResponseWriter, r *http.Request) {
 	logger := log.Of(r.Context())
 
 	root := &Node{Name: "root", Type: "dir"}
+	for _, e := range groupFamilies(listAccessible(r.Context(), access)) {
+		insertPath(root, e)
+	}
+	root.getSize()
+	if err := response.JSON(w, root.Children, http.StatusOK); err != nil {
+		logger.Error("failed to write response", zap.Error(err))
+	}
+}
+
+// entry is a path the user can see, with the path to open for it, the
+// operations allowed on it and, for a log, its rotated files.
+type entry struct {
+	Path     string
+	Resolved string
+	IsDir    bool
+	Ops      []auth.Op
+	Members  []entry
+}
+
+// listAccessible expands the user's access patterns into the paths they may see.
+func listAccessible(ctx context.Context, access auth.Rules) []entry {
+	logger := log.Of(ctx)
+	var entries []entry
 	processed := make(map[string]bool)
 
-	for _, pat := range access {
-		matches, patErr := filepath.Glob(pat)
+	for _, pat := range access.Allow() {
+		matches, patErr := doublestar.FilepathGlob(pat)
 		if patErr != nil {
 			logger.Error(
 				"failed to parse glob pattern",
@@ -115,18 +159,20 @@ func Ls(w http.ResponseWriter, r *http.Request) {
 			if processed[cleanedPath] {
 				continue
 			}
+			resolved, ops, err := access.Ops(cleanedPath)
+			if err != nil {
+				logger.Debug("skipping inaccessible path", zap.String("path", cleanedPath))
+				continue
+			}
 
-			stat, err := os.Stat(cleanedPath)
+			stat, err := os.Stat(resolved)
 			if err != nil {
 				logger.Warn("failed to stat file", zap.String("path", cleanedPath), zap.Error(err))
 				continue
 			}
-			insertPath(root, cleanedPath, stat.IsDir())
+			entries = append(entries, entry{Path: cleanedPath, Resolved: resolved, IsDir: stat.IsDir(), Ops: ops})
 			processed[cleanedPath] = true
 		}
 	}
-	root.getSize()
-	if err := response.JSON(w, root.Children, http.StatusOK); err != nil {
-		logger.Error("failed to write response", zap.Error(err))
-	}
+	return entries
 }
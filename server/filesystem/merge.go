@@ -0,0 +1,274 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/server/auth"
+	"github.com/fmotalleb/timber/server/helper"
+)
+
+const maxMergeFiles = 32
+
+// mergedLine is a line of a merged tail, labeled with its file. Time is the
+// timestamp found in the line, if any. Rotation and truncation of a followed
+// file are reported with Event instead of Text.
+type mergedLine struct {
+	File  string `json:"file"`
+	Time  string `json:"time,omitempty"`
+	Text  string `json:"text,omitempty"`
+	Event string `json:"event,omitempty"`
+}
+
+// mergeSource is a file of a merged tail.
+type mergeSource struct {
+	name     string
+	resolved string
+	f        *os.File
+	follow   bool
+	lines    []timedLine
+}
+
+// timedLine is a line with the timestamp used to order it. Lines without a
+// timestamp, such as stack traces, take the one of the line before them.
+type timedLine struct {
+	Time  time.Time
+	Found bool
+	Text  string
+}
+
+// Merge returns the last n lines of several files, given as repeated `path`
+// parameters, interleaved in timestamp order as NDJSON records labeled with
+// their file. With `follow=true` it then streams the lines appended to any of
+// them, in the order they are read.
+func Merge(w http.ResponseWriter, r *http.Request) {
+	logger := log.Of(r.Context())
+	lines := getLinesParam(r, defaultLineCount)
+	follow := helper.GetFlag(r, "follow")
+	sources, status, err := openMergeSources(r, follow)
+	defer func() {
+		for _, src := range sources {
+			src.f.Close()
+		}
+	}()
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	for _, src := range sources {
+		if err = src.readTail(lines); err != nil {
+			logger.Error("failed to read file", zap.String("path", src.name), zap.Error(err))
+			http.Error(w, "failed to read file", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	out := newFlushWriter(w)
+	defer out.Close()
+	enc := json.NewEncoder(out)
+	for _, l := range mergeTails(sources, lines) {
+		if err = enc.Encode(l); err != nil {
+			logger.Warn("failed to write response", zap.Error(err))
+			return
+		}
+	}
+	if follow {
+		followMerged(r.Context(), sources, enc)
+	}
+}
+
+// openMergeSources checks the permission of the user on every requested path,
+// as PermissionCheck does for one, and opens them. On error it returns the
+// status to reply with.
+func openMergeSources(r *http.Request, follow bool) ([]*mergeSource, int, error) {
+	paths := r.URL.Query()["path"]
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+	switch {
+	case len(paths) == 0:
+		return nil, http.StatusBadRequest, errors.New("missing `path` query parameter")
+	case len(paths) > maxMergeFiles:
+		return nil, http.StatusBadRequest, errors.New("too many `path` query parameters")
+	}
+	op := auth.OpTail
+	if follow {
+		op = auth.OpFollow
+	}
+	sources := make([]*mergeSource, 0, len(paths))
+	for _, p := range paths {
+		resolved, err := auth.Authorize(r.Context(), p, op)
+		switch {
+		case errors.Is(err, auth.ErrorInvalidPath):
+			return sources, http.StatusBadRequest, errors.New("invalid path: " + p)
+		case err != nil:
+			return sources, http.StatusForbidden, errors.New("permission denied: " + p)
+		}
+		f, err := os.Open(resolved)
+		if err != nil {
+			return sources, http.StatusNotFound, errors.New("file not found: " + p)
+		}
+		sources = append(sources, &mergeSource{name: p, resolved: resolved, f: f, follow: follow})
+	}
+	return sources, http.StatusOK, nil
+}
+
+// readTail reads the last n lines of the source. Compressed files are read
+// whole and not followed; followed files are left at the end of their last
+// complete line.
+func (src *mergeSource) readTail(n int) error {
+	c, err := detectCompression(src.f)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	switch {
+	case c != nil:
+		src.follow = false
+		lines, err = tailCompressed(src.f, n)
+	case !src.follow:
+		lines, err = tailLines(src.f, n)
+	default:
+		lines, err = src.tailComplete(n)
+	}
+	if err != nil {
+		return err
+	}
+	var last timedLine
+	for _, l := range lines {
+		if l = strings.TrimSuffix(l, "\r"); l == "" {
+			continue
+		}
+		last.Text = l
+		if t, ok := lineTime([]byte(l)); ok {
+			last.Time, last.Found = t, true
+		}
+		src.lines = append(src.lines, last)
+	}
+	return nil
+}
+
+// tailComplete returns the last n complete lines of the source and leaves the
+// file right after them, so a partial line is followed once it is completed.
+func (src *mergeSource) tailComplete(n int) ([]string, error) {
+	start, err := lastLinesStart(src.f, n)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = src.f.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(src.f)
+	if err != nil {
+		return nil, err
+	}
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if _, err = src.f.Seek(start+int64(end), io.SeekStart); err != nil || end == 0 {
+		return nil, err
+	}
+	return strings.Split(string(data[:end-1]), "\n"), nil
+}
+
+// mergeTails interleaves the tails of the sources by timestamp and returns the
+// last n lines. Lines of a file keep their order; lines before the first
+// timestamp of a file come first.
+func mergeTails(sources []*mergeSource, n int) []mergedLine {
+	var merged []mergedLine
+	next := make([]int, len(sources))
+	for {
+		pick := -1
+		for i, src := range sources {
+			if next[i] == len(src.lines) {
+				continue
+			}
+			if pick < 0 || src.lines[next[i]].Time.Before(sources[pick].lines[next[pick]].Time) {
+				pick = i
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		l := sources[pick].lines[next[pick]]
+		next[pick]++
+		merged = append(merged, newMergedLine(sources[pick].name, l.Text, l.Found, l.Time))
+	}
+	return merged[max(0, len(merged)-n):]
+}
+
+// newMergedLine labels a line with its file and, when found, its timestamp.
+func newMergedLine(name, text string, found bool, t time.Time) mergedLine {
+	l := mergedLine{File: name, Text: text}
+	if found {
+		l.Time = t.Format(time.RFC3339Nano)
+	}
+	return l
+}
+
+// followMerged streams the lines appended to the followed sources as one
+// stream, until ctx is done or writing fails.
+func followMerged(ctx context.Context, sources []*mergeSource, enc *json.Encoder) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lines := make(chan mergedLine)
+	var wg sync.WaitGroup
+	for _, src := range sources {
+		if !src.follow {
+			continue
+		}
+		fl, err := newFollower(src.resolved, src.f)
+		if err != nil {
+			log.Of(ctx).Error("failed to follow file", zap.String("path", src.name), zap.Error(err))
+			continue
+		}
+		var last timedLine
+		if len(src.lines) > 0 {
+			last = src.lines[len(src.lines)-1]
+		}
+		wg.Go(func() {
+			defer fl.Close()
+			ferr := followLines(ctx, fl, func(l followedLine) error {
+				ml := mergedLine{File: src.name}
+				if l.Event != followData {
+					ml.Event = followEventName(l.Event)
+				} else {
+					if t, ok := lineTime(l.Text); ok {
+						last.Time, last.Found = t, true
+					}
+					ml = newMergedLine(src.name, string(l.Text), last.Found, last.Time)
+				}
+				select {
+				case lines <- ml:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}, func() error { return nil })
+			if ferr != nil && ctx.Err() == nil {
+				log.Of(ctx).Warn("failed to follow file", zap.String("path", src.name), zap.Error(ferr))
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+	for l := range lines {
+		if err := enc.Encode(l); err != nil {
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package filesystem
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestMergeTails(t *testing.T) {
+	const (
+		t0 = "2024-05-01T10:00:00Z"
+		t1 = "2024-05-01T10:00:01Z"
+		t2 = "2024-05-01T10:00:02Z"
+		t3 = "2024-05-01T10:00:03Z"
+		t4 = "2024-05-01T10:00:04Z"
+	)
+	files := map[string]string{
+		"a": t0 + " a1\n" + t2 + " a2\n  at trace\n" + t4 + " a3\n",
+		"b": "b0\n" + t1 + " b1\n" + t3 + " b2",
+		"c": t2 + " c1\n",
+		"d": "d1\n\nd2\n",
+	}
+	tests := []struct {
+		name  string
+		files []string
+		n     int
+		want  []mergedLine
+	}{
+		{
+			"interleaved by timestamp",
+			[]string{"a", "b", "c"}, 10,
+			[]mergedLine{
+				{File: "b", Text: "b0"},
+				{File: "a", Time: t0, Text: t0 + " a1"},
+				{File: "b", Time: t1, Text: t1 + " b1"},
+				{File: "a", Time: t2, Text: t2 + " a2"},
+				// The trace inherits the timestamp of the line before it.
+				{File: "a", Time: t2, Text: "  at trace"},
+				{File: "c", Time: t2, Text: t2 + " c1"},
+				{File: "b", Time: t3, Text: t3 + " b2"},
+				{File: "a", Time: t4, Text: t4 + " a3"},
+			},
+		},
+		{
+			"last lines across files",
+			[]string{"a", "b", "c"}, 3,
+			[]mergedLine{
+				{File: "c", Time: t2, Text: t2 + " c1"},
+				{File: "b", Time: t3, Text: t3 + " b2"},
+				{File: "a", Time: t4, Text: t4 + " a3"},
+			},
+		},
+		{
+			"untimestamped lines come first",
+			[]string{"c", "d"}, 10,
+			[]mergedLine{
+				{File: "d", Text: "d1"},
+				{File: "d", Text: "d2"},
+				{File: "c", Time: t2, Text: t2 + " c1"},
+			},
+		},
+		{
+			"single file",
+			[]string{"a"}, 2,
+			[]mergedLine{
+				// The tail starts after the timestamp the trace would inherit.
+				{File: "a", Text: "  at trace"},
+				{File: "a", Time: t4, Text: t4 + " a3"},
+			},
+		},
+	}
+	dir := t.TempDir()
+	paths := make(map[string]string, len(files))
+	for name, content := range files {
+		paths[name] = writeTestFile(t, dir, name+".log", content)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sources []*mergeSource
+			for _, name := range tt.files {
+				f, err := os.Open(paths[name])
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				src := &mergeSource{name: name, resolved: paths[name], f: f}
+				if err = src.readTail(tt.n); err != nil {
+					t.Fatal(err)
+				}
+				sources = append(sources, src)
+			}
+			if got := mergeTails(sources, tt.n); !slices.Equal(got, tt.want) {
+				t.Errorf("mergeTails() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package filesystem
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/server/auth"
+	"github.com/fmotalleb/timber/server/helper"
+	"github.com/fmotalleb/timber/server/parser"
+)
+
+const defaultParseLines = 1000
+
+// parsedLine is a line of a file with the fields its parser found in it.
+// Fields is omitted for lines the parser does not understand.
+type parsedLine struct {
+	Line   int64          `json:"line"`
+	Fields map[string]any `json:"fields,omitempty"`
+	Raw    string         `json:"raw"`
+}
+
+// Parse returns lines `from_line` through `to_line` (1-based, inclusive) of a
+// file, decompressing compressed files, as NDJSON records of the fields parsed
+// from each line along with the raw line. The parser is the one configured for
+// the access group of the file, else the one named by `parser`, else it is
+// detected from the first lines; it is reported in X-Parser.
+// With `family=true` the log and its rotated files are read as one, oldest first.
+func Parse(w http.ResponseWriter, r *http.Request) {
+	logger := log.Of(r.Context())
+	filePath, ok := helper.GetPath(r)
+	if !ok {
+		http.Error(w, "missing `path` query parameter", http.StatusBadRequest)
+		return
+	}
+	p, err := requestParser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseRangeParams(r, "from_line", "to_line", 1, defaultParseLines-1, maxLineCount-1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		src io.ReadCloser
+		c   *compression
+	)
+	if members := familyMembers(r, auth.OpParse); members != nil {
+		src = newFamilyReader(members)
+	} else {
+		f, openErr := os.Open(filePath)
+		if openErr != nil {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		if src, c, err = textReader(f); err != nil {
+			logger.Error("failed to read file", zap.Error(err))
+			http.Error(w, "failed to read file", http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	defer src.Close()
+
+	reader := bufio.NewReaderSize(src, readChunkSize)
+	sample, number, err := readSample(reader, from, to)
+	if err != nil && !errors.Is(err, io.EOF) {
+		logger.Error("failed to read file", zap.Error(err))
+		http.Error(w, "failed to read file", http.StatusUnprocessableEntity)
+		return
+	}
+	if p == nil {
+		p = parser.Detect(sample)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	setCompressionHeader(w, c)
+	if p != nil {
+		w.Header().Set("X-Parser", p.Name())
+	}
+	w.WriteHeader(http.StatusOK)
+	out := newFlushWriter(w)
+	defer out.Close()
+	enc := json.NewEncoder(out)
+	emit := func(n int64, text []byte) bool {
+		l := parsedLine{Line: n, Raw: string(text)}
+		if p != nil {
+			if fields, ok := p.Parse(text); ok {
+				l.Fields = fields
+			}
+		}
+		if encErr := enc.Encode(l); encErr != nil {
+			logger.Warn("failed to write response", zap.Error(encErr))
+			return false
+		}
+		return true
+	}
+	for i, text := range sample {
+		if !emit(from+int64(i), text) {
+			return
+		}
+	}
+	for err == nil && number < to && r.Context().Err() == nil {
+		var text []byte
+		if text, err = readLine(reader); len(text) == 0 && err != nil {
+			break
+		}
+		number++
+		if !emit(number, text) {
+			return
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		logger.Warn("failed to read file", zap.Error(err))
+	}
+}
+
+// requestParser returns the parser for the file of a request: the one of the
+// access group granting `parse` on it, else the one named by the `parser`
+// parameter. It returns nil when the parser is to be detected.
+// The regex parser can only be configured, as its pattern is part of the access group.
+func requestParser(r *http.Request) (parser.Parser, error) {
+	access, _ := auth.AccessFromContext(r.Context())
+	name, pattern := access.Parser(r.URL.Query().Get("path"), auth.OpParse)
+	if name == "" {
+		name = r.URL.Query().Get("parser")
+		if name == parser.Regex {
+			return nil, errors.New("the regex parser is only available from the access configuration")
+		}
+	}
+	return parser.New(name, pattern)
+}
+
+// readSample reads past the lines before from and returns the lines from there
+// that detection looks at, up to line to, and the number of lines read.
+func readSample(reader *bufio.Reader, from, to int64) ([][]byte, int64, error) {
+	var sample [][]byte
+	number, err := skipLines(reader, from-1)
+	for err == nil && number < to && len(sample) < parser.DetectLines {
+		var text []byte
+		if text, err = readLine(reader); len(text) > 0 || err == nil {
+			sample = append(sample, text)
+			number++
+		}
+	}
+	return sample, number, err
+}
+
+// skipLines reads past n lines and returns the number of lines read.
+func skipLines(reader *bufio.Reader, n int64) (int64, error) {
+	var read int64
+	for read < n {
+		text, err := readLine(reader)
+		if len(text) == 0 && err != nil {
+			return read, err
+		}
+		read++
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
@@ -0,0 +1,230 @@
+package filesystem
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/server/auth"
+	"github.com/fmotalleb/timber/server/helper"
+)
+
+const (
+	defaultRangeBytes = 64 * 1024
+	maxRangeBytes     = 16 << 20
+)
+
+// lineRange is a line-aligned byte range of a file.
+// Start and LastStart are the offsets of the first and last line, End is the
+// offset right after the last line, and FirstLine is the 1-based number of the
+// first line (0 when unknown).
+type lineRange struct {
+	FirstLine int64
+	Start     int64
+	LastStart int64
+	End       int64
+}
+
+// Range returns lines `from_line` through `to_line` (1-based, inclusive), or the
+// lines overlapping bytes `from_byte` to `to_byte` (exclusive) of a file.
+// The byte offsets of the returned lines are reported in response headers, so
+// X-Range-End-Offset can be used as `from_byte` of the next page.
+// With `family=true` the log and its rotated files are read as one, oldest first,
+// and offsets count from the start of the oldest rotated file.
+func Range(w http.ResponseWriter, r *http.Request) {
+	logger := log.Of(r.Context())
+	filePath, ok := helper.GetPath(r)
+	if !ok {
+		http.Error(w, "missing `path` query parameter", http.StatusBadRequest)
+		return
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		logger.Error("failed to stat file", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	c, err := detectCompression(f)
+	if err != nil {
+		logger.Error("failed to read file", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var lr lineRange
+	q := r.URL.Query()
+	byteMode := q.Has("from_byte") || q.Has("to_byte")
+	var from, to int64
+	if byteMode {
+		from, to, err = parseRangeParams(r, "from_byte", "to_byte", 0, defaultRangeBytes, maxRangeBytes)
+	} else {
+		from, to, err = parseRangeParams(r, "from_line", "to_line", 1, defaultLineCount-1, maxLineCount-1)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Ranges of streamed content are read while they are found.
+	var content []byte
+	members := familyMembers(r, auth.OpRange)
+	switch {
+	case members != nil:
+		lr, content, err = familyRange(members, byteMode, from, to)
+	case c != nil:
+		lr, content, err = compressedRange(f, byteMode, from, to)
+	case byteMode:
+		lr, err = byteRange(f, stat.Size(), from, to)
+	default:
+		lr, err = lineNumberRange(f, from, to)
+	}
+	if err != nil {
+		logger.Error("failed to read file", zap.Error(err))
+		http.Error(w, "failed to read file", http.StatusUnprocessableEntity)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("X-Range-First-Offset", strconv.FormatInt(lr.Start, 10))
+	h.Set("X-Range-Last-Offset", strconv.FormatInt(lr.LastStart, 10))
+	h.Set("X-Range-End-Offset", strconv.FormatInt(lr.End, 10))
+	if lr.FirstLine > 0 {
+		h.Set("X-Range-First-Line", strconv.FormatInt(lr.FirstLine, 10))
+	}
+	switch {
+	case members != nil:
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(content)
+	case c != nil:
+		// Offsets refer to the decompressed content, whose size is unknown.
+		setCompressionHeader(w, c)
+		w.WriteHeader(http.StatusOK)
+		_, err = w.Write(content)
+	default:
+		h.Set("X-File-Size", strconv.FormatInt(stat.Size(), 10))
+		w.WriteHeader(http.StatusOK)
+		_, err = io.Copy(w, io.NewSectionReader(f, lr.Start, lr.End-lr.Start))
+	}
+	if err != nil {
+		logger.Warn("failed to write response", zap.Error(err))
+	}
+}
+
+// parseRangeParams parses the from and to query parameters of a range.
+// A missing from defaults to minFrom, and a missing to defaults to from + span.
+// To is capped at from + maxSpan.
+func parseRangeParams(r *http.Request, fromName, toName string, minFrom, span, maxSpan int64) (int64, int64, error) {
+	q := r.URL.Query()
+	from := minFrom
+	var err error
+	if v := q.Get(fromName); v != "" {
+		if from, err = strconv.ParseInt(v, 10, 64); err != nil || from < minFrom || from > math.MaxInt64-maxSpan {
+			return 0, 0, errors.New("invalid `" + fromName + "` query parameter")
+		}
+	}
+	to := from + span
+	if v := q.Get(toName); v != "" {
+		if to, err = strconv.ParseInt(v, 10, 64); err != nil || to < from {
+			return 0, 0, errors.New("invalid `" + toName + "` query parameter")
+		}
+	}
+	return from, min(to, from+maxSpan), nil
+}
+
+// lineNumberRange finds lines from through to (1-based, inclusive).
+// Lines past the end of the file are omitted.
+func lineNumberRange(r io.Reader, from, to int64) (lineRange, error) {
+	lr := lineRange{FirstLine: from, Start: -1}
+	var n, offset int64
+	err := scanLines(r, 0, func(start, end int64) bool {
+		n++
+		offset = end
+		if n == from {
+			lr.Start = start
+		}
+		if n >= from {
+			lr.LastStart, lr.End = start, end
+		}
+		return n < to
+	})
+	if lr.Start < 0 {
+		lr = lineRange{Start: offset, LastStart: offset, End: offset}
+	}
+	return lr, err
+}
+
+// byteRange finds the lines overlapping bytes from to to (exclusive).
+func byteRange(f io.ReaderAt, size, from, to int64) (lineRange, error) {
+	if from >= size {
+		return lineRange{Start: size, LastStart: size, End: size}, nil
+	}
+	start, err := lineStartBefore(f, from)
+	if err != nil {
+		return lineRange{}, err
+	}
+	lr := lineRange{Start: start, LastStart: start, End: start}
+	err = scanLines(io.NewSectionReader(f, start, size-start), start, func(lineStart, end int64) bool {
+		lr.LastStart, lr.End = lineStart, end
+		return end < to
+	})
+	return lr, err
+}
+
+// lineStartBefore returns the offset of the line containing pos.
+func lineStartBefore(f io.ReaderAt, pos int64) (int64, error) {
+	buf := make([]byte, readChunkSize)
+	for pos > 0 {
+		n := min(int64(len(buf)), pos)
+		if _, err := f.ReadAt(buf[:n], pos-n); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] == '\n' {
+				return pos - n + i + 1, nil
+			}
+		}
+		pos -= n
+	}
+	return 0, nil
+}
+
+// scanLines calls fn with the offsets of every line of r, where a line's end
+// includes its newline, until fn returns false. base is the offset of r in the file.
+func scanLines(r io.Reader, base int64, fn func(start, end int64) bool) error {
+	reader := bufio.NewReaderSize(r, readChunkSize)
+	start, offset := base, base
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		offset += int64(len(chunk))
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if offset > start {
+			if !fn(start, offset) {
+				return nil
+			}
+			start = offset
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
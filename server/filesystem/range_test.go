@@ -0,0 +1,146 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fmotalleb/timber/server/helper"
+)
+
+// writeTestFile writes content to name under dir, gzip compressed when the
+// name ends with .gz, and returns its path.
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	data := []byte(content)
+	if filepath.Ext(name) == ".gz" {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = buf.Bytes()
+	}
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// serveFile calls handler for path with the query, as PermissionCheck would
+// after resolving the path.
+func serveFile(handler http.HandlerFunc, path, query string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/?path="+path+"&"+query, nil)
+	w := httptest.NewRecorder()
+	handler(w, helper.WithPath(r, path))
+	return w
+}
+
+func TestRange(t *testing.T) {
+	// Lines start at offsets 0, 4, 8 and 14; the file is 19 bytes long.
+	const content = "one\ntwo\nthree\nfour\n"
+	tests := []struct {
+		name      string
+		query     string
+		body      string
+		first     string
+		last      string
+		end       string
+		firstLine string
+	}{
+		{"default lines", "", content, "0", "14", "19", "1"},
+		{"lines", "from_line=2&to_line=3", "two\nthree\n", "4", "8", "14", "2"},
+		{"single line", "from_line=4&to_line=4", "four\n", "14", "14", "19", "4"},
+		{"lines past the end", "from_line=3&to_line=9", "three\nfour\n", "8", "14", "19", "3"},
+		{"from past the end", "from_line=10", "", "19", "19", "19", ""},
+		{"bytes", "from_byte=4&to_byte=8", "two\n", "4", "4", "8", ""},
+		{"bytes within lines", "from_byte=5&to_byte=9", "two\nthree\n", "4", "8", "14", ""},
+		{"bytes from the start", "to_byte=1", "one\n", "0", "0", "4", ""},
+		{"bytes past the end", "from_byte=100", "", "19", "19", "19", ""},
+	}
+	dir := t.TempDir()
+	for _, file := range []string{"app.log", "app.log.gz"} {
+		p := writeTestFile(t, dir, file, content)
+		for _, tt := range tests {
+			t.Run(file+"/"+tt.name, func(t *testing.T) {
+				w := serveFile(Range, p, tt.query)
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+				}
+				if got := w.Body.String(); got != tt.body {
+					t.Errorf("body = %q, want %q", got, tt.body)
+				}
+				headers := map[string]string{
+					"X-Range-First-Offset": tt.first,
+					"X-Range-Last-Offset":  tt.last,
+					"X-Range-End-Offset":   tt.end,
+					"X-Range-First-Line":   tt.firstLine,
+				}
+				for name, want := range headers {
+					if got := w.Header().Get(name); got != want {
+						t.Errorf("%s = %q, want %q", name, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRangeCompressedHeaders(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		file         string
+		size         string
+		decompressed string
+	}{
+		{"app.log", "8", ""},
+		// The size of decompressed content is unknown.
+		{"app.log.gz", "", "gzip"},
+	}
+	for _, tt := range tests {
+		w := serveFile(Range, writeTestFile(t, dir, tt.file, "one\ntwo\n"), "")
+		if got := w.Header().Get("X-File-Size"); got != tt.size {
+			t.Errorf("%s: X-File-Size = %q, want %q", tt.file, got, tt.size)
+		}
+		if got := w.Header().Get("X-Decompressed-From"); got != tt.decompressed {
+			t.Errorf("%s: X-Decompressed-From = %q, want %q", tt.file, got, tt.decompressed)
+		}
+	}
+}
+
+func TestParseRangeParams(t *testing.T) {
+	tests := []struct {
+		query    string
+		from, to int64
+	}{
+		{"", 1, 10},
+		{"from_line=5", 5, 14},
+		{"from_line=5&to_line=7", 5, 7},
+		{"from_line=5&to_line=1000000", 5, 104},
+		{"to_line=1000000", 1, 100},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		from, to, err := parseRangeParams(r, "from_line", "to_line", 1, 9, 99)
+		if err != nil || from != tt.from || to != tt.to {
+			t.Errorf("parseRangeParams(%q) = %d, %d, %v, want %d, %d", tt.query, from, to, err, tt.from, tt.to)
+		}
+	}
+}
+
+func TestRangeInvalid(t *testing.T) {
+	p := writeTestFile(t, t.TempDir(), "app.log", "one\n")
+	for _, query := range []string{"from_line=0", "from_line=x", "from_line=3&to_line=2", "from_byte=-1", "from_byte=5&to_byte=4", "from_byte=9223372036854775807"} {
+		if w := serveFile(Range, p, query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/server/auth"
+	"github.com/fmotalleb/timber/server/response"
+)
+
+const (
+	maxSearchWorkers     = 8
+	defaultSearchResults = 1000
+	maxSearchResults     = 100000
+	defaultSearchTimeout = 10 * time.Second
+	maxSearchTimeout     = 5 * time.Minute
+)
+
+// searchResult is a line found by a multi-file search.
+type searchResult struct {
+	File    string `json:"file"`
+	Line    int64  `json:"line"`
+	Text    string `json:"text"`
+	Context bool   `json:"context,omitempty"`
+}
+
+// searchSummary is the last record of a multi-file search.
+type searchSummary struct {
+	Files     int    `json:"files"`
+	Matches   int    `json:"matches"`
+	Truncated string `json:"truncated,omitempty"`
+}
+
+// Search streams the lines matching `pattern` in every file the user may grep,
+// as NDJSON records with the file, line number and text. Rotated files are
+// searched with their log, oldest first, and numbered across them. It takes the options
+// of Grep, plus `max_results` and `timeout` budgets; the last record is a summary
+// that tells whether a budget cut the search short.
+func Search(w http.ResponseWriter, r *http.Request) {
+	access, ok := auth.AccessFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w)
+		return
+	}
+	logger := log.Of(r.Context())
+	opts, err := parseGrepOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	maxResults, err := getIntParam(r, "max_results", defaultSearchResults, maxSearchResults)
+	if err == nil && maxResults < 1 {
+		err = errors.New("invalid `max_results` query parameter")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout := defaultSearchTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		if timeout, err = time.ParseDuration(v); err != nil || timeout <= 0 || timeout > maxSearchTimeout {
+			http.Error(w, "invalid `timeout` query parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	files := searchableFiles(r.Context(), access)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	results := searchFiles(ctx, files, opts)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	out := newFlushWriter(w)
+	enc := json.NewEncoder(out)
+
+	summary := searchSummary{Files: len(files)}
+	for res := range results {
+		if summary.Matches >= maxResults {
+			continue
+		}
+		if !res.Context {
+			summary.Matches++
+		}
+		if err = enc.Encode(res); err != nil {
+			cancel()
+		}
+		if summary.Matches >= maxResults {
+			summary.Truncated = "max_results"
+			cancel()
+		}
+	}
+	if summary.Truncated == "" && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		summary.Truncated = "timeout"
+	}
+	if err = enc.Encode(map[string]searchSummary{"summary": summary}); err != nil {
+		logger.Warn("failed to write response", zap.Error(err))
+	}
+	out.Close()
+}
+
+// searchTarget is a file to search, by its listed path and the resolved paths
+// to read: its rotated files, oldest first, and itself.
+type searchTarget struct {
+	Name     string
+	Resolved []string
+}
+
+// searchableFiles returns the listed files the user may grep. A log and its
+// rotated files are searched as one.
+func searchableFiles(ctx context.Context, access auth.Rules) []searchTarget {
+	var entries []entry
+	for _, e := range listAccessible(ctx, access) {
+		if !e.IsDir && slices.Contains(e.Ops, auth.OpGrep) {
+			entries = append(entries, e)
+		}
+	}
+	var files []searchTarget
+	for _, e := range groupFamilies(entries) {
+		target := searchTarget{Name: e.Path}
+		for _, m := range slices.Concat(e.Members, []entry{e}) {
+			target.Resolved = append(target.Resolved, m.Resolved)
+		}
+		files = append(files, target)
+	}
+	return files
+}
+
+// searchFiles greps files with a bounded pool of workers until ctx is done.
+// The returned channel is closed once every worker finished.
+func searchFiles(ctx context.Context, files []searchTarget, opts grepOptions) <-chan searchResult {
+	jobs := make(chan searchTarget)
+	results := make(chan searchResult)
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), maxSearchWorkers) {
+		wg.Go(func() {
+			for f := range jobs {
+				searchFile(ctx, f, opts, results)
+			}
+		})
+	}
+	go func() {
+		defer close(jobs)
+		for _, f := range files {
+			select {
+			case jobs <- f:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// searchFile sends the matches of one file to results.
+func searchFile(ctx context.Context, target searchTarget, opts grepOptions, results chan<- searchResult) {
+	src := newFamilyReader(target.Resolved)
+	defer src.Close()
+	err := grepReader(ctx, src, opts, func(l grepLine) bool {
+		select {
+		case results <- searchResult{File: target.Name, Line: l.Number, Text: string(l.Text), Context: !l.Match}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Of(ctx).Warn("failed to search file", zap.String("path", target.Name), zap.Error(err))
+	}
+}
@@ -0,0 +1,312 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fmotalleb/go-tools/log"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/server/auth"
+)
+
+const (
+	maxStreamSubscriptions = 64
+	maxStreamRequestSize   = 4096
+	streamPingInterval     = 30 * time.Second
+	streamPongWait         = 2 * streamPingInterval
+	streamWriteWait        = 10 * time.Second
+)
+
+// Message types sent to stream clients.
+const (
+	streamSubscribed   = "subscribed"
+	streamUnsubscribed = "unsubscribed"
+	streamLine         = "line"
+	streamError        = "error"
+)
+
+// The default origin check rejects cross-site connections, which would otherwise
+// ride on the session cookie.
+var upgrader = websocket.Upgrader{}
+
+// streamRequest is a message from a stream client. Lines is the number of
+// existing lines to send first (default 10), and Offset the byte offset to
+// resume at instead, as reported by a previous line message.
+type streamRequest struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Lines  *int   `json:"lines,omitempty"`
+	Offset *int64 `json:"offset,omitempty"`
+}
+
+// streamMessage is a message to a stream client, tagged with the path it is about.
+// Line messages carry the offset right after the line.
+type streamMessage struct {
+	Type   string `json:"type"`
+	Path   string `json:"path,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+	Line   string `json:"line,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// streamConn is a WebSocket connection following several files.
+type streamConn struct {
+	ctx  context.Context
+	out  chan streamMessage
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	subs map[string]*streamSub
+}
+
+// streamSub is a subscription of a stream connection.
+type streamSub struct {
+	cancel context.CancelFunc
+}
+
+// Stream follows several files over one WebSocket connection. The client sends
+// `{"action":"subscribe","path":"..."}` and `{"action":"unsubscribe","path":"..."}`
+// messages, and receives the lines of its subscriptions as `line` messages tagged
+// with their path, plus `rotated` and `truncated` messages. Every subscription is
+// checked against the `follow` permission of the user.
+func Stream(w http.ResponseWriter, r *http.Request) {
+	logger := log.Of(r.Context())
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied.
+		logger.Debug("failed to upgrade connection", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	s := &streamConn{
+		ctx:  ctx,
+		out:  make(chan streamMessage),
+		subs: make(map[string]*streamSub),
+	}
+	s.wg.Go(func() {
+		defer cancel()
+		s.readRequests(conn)
+	})
+	err = s.writeMessages(conn)
+	cancel()
+	// Unblock the reader before waiting for it.
+	conn.Close()
+	s.wg.Wait()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Debug("stream closed", zap.Error(err))
+	}
+}
+
+// readRequests handles the requests of the client until the connection fails.
+func (s *streamConn) readRequests(conn *websocket.Conn) {
+	conn.SetReadLimit(maxStreamRequestSize)
+	_ = conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req streamRequest
+		if err = json.Unmarshal(data, &req); err != nil {
+			s.send(streamMessage{Type: streamError, Error: "invalid request"})
+			continue
+		}
+		switch req.Action {
+		case "subscribe":
+			s.subscribe(req)
+		case "unsubscribe":
+			s.unsubscribe(req.Path, nil)
+		default:
+			s.send(streamMessage{Type: streamError, Path: req.Path, Error: "unknown action"})
+		}
+	}
+}
+
+// writeMessages writes the messages of all subscriptions and keeps the
+// connection alive, until the connection fails or is closed.
+func (s *streamConn) writeMessages(conn *websocket.Conn) error {
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(streamWriteWait),
+			)
+			return s.ctx.Err()
+		case msg := <-s.out:
+			_ = conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				return err
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// send queues msg for the client, unless the connection is closing.
+func (s *streamConn) send(msg streamMessage) {
+	_ = s.sendWithin(s.ctx, msg)
+}
+
+// sendWithin queues msg for the client, unless ctx is done.
+func (s *streamConn) sendWithin(ctx context.Context, msg streamMessage) error {
+	select {
+	case s.out <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// subscribe checks the permission of the user and starts following the path.
+func (s *streamConn) subscribe(req streamRequest) {
+	resolved, err := auth.Authorize(s.ctx, req.Path, auth.OpFollow)
+	if err != nil {
+		msg := auth.ErrorPermissionDeny.Error()
+		if errors.Is(err, auth.ErrorInvalidPath) {
+			msg = "invalid path"
+		}
+		s.send(streamMessage{Type: streamError, Path: req.Path, Error: msg})
+		return
+	}
+	f, truncated, err := openFollowed(s.ctx, req, resolved)
+	if err != nil {
+		s.send(streamMessage{Type: streamError, Path: req.Path, Error: err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	_, exists := s.subs[req.Path]
+	full := len(s.subs) >= maxStreamSubscriptions
+	var ctx context.Context
+	sub := &streamSub{}
+	if !exists && !full {
+		ctx, sub.cancel = context.WithCancel(s.ctx)
+		s.subs[req.Path] = sub
+	}
+	s.mu.Unlock()
+	switch {
+	case exists:
+		f.Close()
+		s.send(streamMessage{Type: streamError, Path: req.Path, Error: "already subscribed"})
+		return
+	case full:
+		f.Close()
+		s.send(streamMessage{Type: streamError, Path: req.Path, Error: "too many subscriptions"})
+		return
+	}
+
+	s.wg.Go(func() {
+		defer f.Close()
+		defer s.unsubscribe(req.Path, sub)
+		if err := s.follow(ctx, req, f, resolved, truncated); err != nil && ctx.Err() == nil {
+			s.send(streamMessage{Type: streamError, Path: req.Path, Error: err.Error()})
+		}
+	})
+}
+
+// unsubscribe stops following the path, or only the subscription sub when it is
+// not nil. Subscriptions that ended on their own are removed the same way, so the
+// client is always told.
+func (s *streamConn) unsubscribe(path string, sub *streamSub) {
+	s.mu.Lock()
+	current, ok := s.subs[path]
+	ok = ok && (sub == nil || sub == current)
+	if ok {
+		delete(s.subs, path)
+	}
+	s.mu.Unlock()
+	if !ok {
+		if sub == nil {
+			s.send(streamMessage{Type: streamError, Path: path, Error: "not subscribed"})
+		}
+		return
+	}
+	current.cancel()
+	s.send(streamMessage{Type: streamUnsubscribed, Path: path})
+}
+
+// openFollowed opens resolved at the requested offset, or at the start of the
+// requested number of last lines. It reports whether the file shrank below the
+// requested offset, in which case it starts over. Its errors are meant for the client.
+func openFollowed(ctx context.Context, req streamRequest, resolved string) (*os.File, bool, error) {
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, false, errors.New("file not found")
+	}
+	c, err := detectCompression(f)
+	if err == nil && c != nil {
+		f.Close()
+		return nil, false, errors.New("compressed files can not be followed")
+	}
+	var start int64
+	var truncated bool
+	if err == nil {
+		switch {
+		case req.Offset != nil && *req.Offset >= 0:
+			start, truncated, err = resumeOffset(f, *req.Offset)
+		case req.Lines != nil && *req.Lines >= 0:
+			start, err = lastLinesStart(f, *req.Lines)
+		default:
+			start, err = lastLinesStart(f, defaultLineCount)
+		}
+	}
+	if errors.Is(err, errNotLineStart) {
+		f.Close()
+		return nil, false, err
+	}
+	if err == nil {
+		_, err = f.Seek(start, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		log.Of(ctx).Error("failed to read file", zap.String("path", resolved), zap.Error(err))
+		return nil, false, errors.New("failed to read file")
+	}
+	return f, truncated, nil
+}
+
+// follow sends the lines of f, opened from resolved, from its current offset
+// until ctx is done.
+func (s *streamConn) follow(ctx context.Context, req streamRequest, f *os.File, resolved string, truncated bool) error {
+	fl, err := newFollower(resolved, f)
+	if err != nil {
+		log.Of(ctx).Error("failed to follow file", zap.Error(err))
+		return errors.New("failed to follow file")
+	}
+	defer fl.Close()
+
+	if err = s.sendWithin(ctx, streamMessage{Type: streamSubscribed, Path: req.Path}); err != nil {
+		return err
+	}
+	emit := func(l followedLine) error {
+		msg := streamMessage{Type: streamLine, Path: req.Path, Offset: l.End, Line: string(l.Text)}
+		if l.Event != followData {
+			msg = streamMessage{Type: followEventName(l.Event), Path: req.Path}
+		}
+		return s.sendWithin(ctx, msg)
+	}
+	if truncated {
+		if err = emit(followedLine{Event: followTruncated}); err != nil {
+			return err
+		}
+	}
+	return followLines(ctx, fl, emit, func() error { return nil })
+}
@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/fmotalleb/timber/config"
+	"github.com/fmotalleb/timber/server/auth"
+)
+
+// streamTest connects to Stream as a user who may follow the logs in dir,
+// except secret.log.
+func streamTest(t *testing.T, dir string) *websocket.Conn {
+	t.Helper()
+	cfg := config.Config{
+		Users: []config.User{{Name: "alice", AccessList: []string{"logs"}}},
+		Access: map[string]config.Access{
+			"logs": {Paths: []string{filepath.Join(dir, "*.log")}, Deny: []string{filepath.Join(dir, "secret.log")}},
+		},
+	}
+	trusted, err := auth.WithTrustedUser(cfg, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(trusted(http.HandlerFunc(Stream)))
+	t.Cleanup(srv.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// subscribeTest asks the stream to follow path from its last lines lines.
+func subscribeTest(t *testing.T, conn *websocket.Conn, path string, lines int) {
+	t.Helper()
+	if err := conn.WriteJSON(streamRequest{Action: "subscribe", Path: path, Lines: &lines}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectMessages fails the test unless the stream sends want, in order.
+func expectMessages(t *testing.T, conn *websocket.Conn, want ...streamMessage) {
+	t.Helper()
+	for i, w := range want {
+		if got := readStreamMessage(t, conn); got != w {
+			t.Fatalf("message %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+func readStreamMessage(t *testing.T, conn *websocket.Conn) streamMessage {
+	t.Helper()
+	var msg streamMessage
+	_ = conn.SetReadDeadline(time.Now().Add(followTestTimeout))
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestStream(t *testing.T) {
+	dir := t.TempDir()
+	app := writeTestFile(t, dir, "app.log", "one\n")
+	secret := writeTestFile(t, dir, "secret.log", "password\n")
+	conn := streamTest(t, dir)
+
+	subscribeTest(t, conn, app, 10)
+	expectMessages(t, conn,
+		streamMessage{Type: streamSubscribed, Path: app},
+		streamMessage{Type: streamLine, Path: app, Offset: 4, Line: "one"},
+	)
+	subscribeTest(t, conn, secret, 10)
+	expectMessages(t, conn, streamMessage{Type: streamError, Path: secret, Error: auth.ErrorPermissionDeny.Error()})
+	// The denied subscription leaves the others streaming.
+	appendTestFile(t, app, "two\n")
+	expectMessages(t, conn, streamMessage{Type: streamLine, Path: app, Offset: 8, Line: "two"})
+
+	subscribeTest(t, conn, app, 10)
+	expectMessages(t, conn, streamMessage{Type: streamError, Path: app, Error: "already subscribed"})
+	if err := conn.WriteJSON(streamRequest{Action: "unsubscribe", Path: app}); err != nil {
+		t.Fatal(err)
+	}
+	expectMessages(t, conn, streamMessage{Type: streamUnsubscribed, Path: app})
+	appendTestFile(t, app, "three\n")
+	subscribeTest(t, conn, app, 1)
+	expectMessages(t, conn,
+		streamMessage{Type: streamSubscribed, Path: app},
+		streamMessage{Type: streamLine, Path: app, Offset: 14, Line: "three"},
+	)
+}
+
+func TestStreamSubscriptionLimit(t *testing.T) {
+	dir := t.TempDir()
+	conn := streamTest(t, dir)
+	for i := range maxStreamSubscriptions {
+		subscribeTest(t, conn, writeTestFile(t, dir, strconv.Itoa(i)+".log", ""), 0)
+	}
+	for range maxStreamSubscriptions {
+		if msg := readStreamMessage(t, conn); msg.Type != streamSubscribed {
+			t.Fatalf("message = %+v, want a subscription", msg)
+		}
+	}
+	extra := writeTestFile(t, dir, "extra.log", "")
+	subscribeTest(t, conn, extra, 0)
+	expectMessages(t, conn, streamMessage{Type: streamError, Path: extra, Error: "too many subscriptions"})
+}
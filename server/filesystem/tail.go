@@ -8,23 +8,23 @@ import (
 	"github.com/fmotalleb/go-tools/log"
 	"go.uber.org/zap"
 
+	"github.com/fmotalleb/timber/server/auth"
 	"github.com/fmotalleb/timber/server/helper"
 )
 
-// Tail returns the last n lines of a file.
+// Tail returns the last n lines of a file, decompressing compressed files.
+// Compressed files can not be followed. Followers that accept
+// `text/event-stream` get the lines as Server-Sent Events instead.
+// With `family=true` the lines are read across the log and its rotated files.
 func Tail(w http.ResponseWriter, r *http.Request) {
 	filePath, ok := helper.GetPath(r)
 	if !ok {
 		http.Error(w, "missing `path` query parameter", http.StatusBadRequest)
 		return
 	}
-	if containsDotDot(filePath) {
-		http.Error(w, "invalid path", http.StatusBadRequest)
-		return
-	}
 
 	lines := getLinesParam(r, defaultLineCount)
-	follow := getFollowParam(r)
+	follow := helper.GetFlag(r, "follow")
 
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -33,9 +33,38 @@ func Tail(w http.ResponseWriter, r *http.Request) {
 	}
 	defer f.Close()
 
+	c, err := detectCompression(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if follow && c == nil && wantsEvents(r) {
+		if helper.GetFlag(r, "family") {
+			http.Error(w, "`family` is not supported with Server-Sent Events", http.StatusBadRequest)
+			return
+		}
+		followEvents(w, r, f, filePath, lines)
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
-	last, err := tailLines(f, lines)
+	op := auth.OpTail
+	if follow {
+		op = auth.OpFollow
+	}
+	members := familyMembers(r, op)
+	var last []string
+	switch {
+	case c != nil:
+		// Compressed files can not be read backwards, nor do they grow.
+		follow = false
+		last, err = tailCompressed(f, lines)
+		setCompressionHeader(w, c)
+	case members != nil:
+		last, err = tailFamily(members, lines)
+	default:
+		last, err = tailLines(f, lines)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -51,6 +80,6 @@ func Tail(w http.ResponseWriter, r *http.Request) {
 
 	if follow {
 		_, _ = f.Seek(0, io.SeekEnd)
-		followFile(w, r, f)
+		followFile(w, r, f, filePath)
 	}
 }
@@ -0,0 +1,62 @@
+package filesystem
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+)
+
+const (
+	// maxTimestampSearch is how far into a line a timestamp is looked for.
+	maxTimestampSearch = 256
+	// yearlessClockSkew is how far in the future a timestamp without a year may be.
+	yearlessClockSkew = 24 * time.Hour
+)
+
+var (
+	// ISO 8601 / RFC 3339, as written by most structured loggers: 2006-01-02T15:04:05.000Z.
+	isoTimestamp = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`)
+	// Common log format, as written by nginx and Apache: 02/Jan/2006:15:04:05 -0700.
+	clfTimestamp = regexp.MustCompile(`\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`)
+	// BSD syslog, without a year and maybe after the priority: <13>Jan _2 15:04:05.
+	syslogTimestamp = regexp.MustCompile(`^(?:<\d{1,3}>)?([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2})`)
+
+	isoLayouts = []string{"2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05"}
+)
+
+// lineTime returns the timestamp of a log line, found near its start in one of
+// the common log formats. Timestamps without a zone are in local time.
+func lineTime(line []byte) (time.Time, bool) {
+	head := line[:min(len(line), maxTimestampSearch)]
+	if m := isoTimestamp.Find(head); m != nil {
+		// Normalize the date-time separator and decimal comma for time.Parse.
+		s := string(bytes.Replace(bytes.Replace(m, []byte(" "), []byte("T"), 1), []byte(","), []byte("."), 1))
+		for _, layout := range isoLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	if m := clfTimestamp.Find(head); m != nil {
+		if t, err := time.Parse("02/Jan/2006:15:04:05 -0700", string(m)); err == nil {
+			return t, true
+		}
+	}
+	if m := syslogTimestamp.FindSubmatch(head); m != nil {
+		if t, err := time.ParseInLocation(time.Stamp, string(m[1]), time.Local); err == nil {
+			return withRecentYear(t), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// withRecentYear sets the year of a timestamp logged without one, assuming it
+// is not in the future.
+func withRecentYear(t time.Time) time.Time {
+	now := time.Now()
+	t = t.AddDate(now.Year()-t.Year(), 0, 0)
+	if t.After(now.Add(yearlessClockSkew)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
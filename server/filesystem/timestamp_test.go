@@ -0,0 +1,92 @@
+package filesystem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLineTime(t *testing.T) {
+	utc := time.Date(2024, time.May, 1, 10, 30, 15, 0, time.UTC)
+	local := time.Date(2024, time.May, 1, 10, 30, 15, 0, time.Local)
+	tests := []struct {
+		name string
+		line string
+		want time.Time
+		ok   bool
+	}{
+		{"rfc3339", "2024-05-01T10:30:15Z INFO started", utc, true},
+		{"rfc3339 with offset", "2024-05-01T12:30:15+02:00 started", utc, true},
+		{"offset without colon", "2024-05-01T12:30:15+0200 started", utc, true},
+		{"fraction", "2024-05-01T10:30:15.250Z started", utc.Add(250 * time.Millisecond), true},
+		{"space and decimal comma", "2024-05-01 10:30:15,250 INFO started", local.Add(250 * time.Millisecond), true},
+		{"without zone", "2024-05-01T10:30:15 started", local, true},
+		{"inside json", `{"level":"info","time":"2024-05-01T10:30:15Z","msg":"started"}`, utc, true},
+		{"logfmt", "level=info ts=2024-05-01T10:30:15Z msg=started", utc, true},
+		{
+			"common log format",
+			`127.0.0.1 - - [01/May/2024:12:30:15 +0200] "GET / HTTP/1.1" 200 5`,
+			utc, true,
+		},
+		{"invalid date", "2024-13-01T10:30:15Z started", time.Time{}, false},
+		{"no timestamp", "started without a time", time.Time{}, false},
+		{"empty", "", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := lineTime([]byte(tt.line))
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("lineTime(%q) = %v, %v, want %v, %v", tt.line, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLineTimeSearchLimit(t *testing.T) {
+	line := make([]byte, maxTimestampSearch)
+	for i := range line {
+		line[i] = 'x'
+	}
+	line = append(line, " 2024-05-01T10:30:15Z"...)
+	if got, ok := lineTime(line); ok {
+		t.Errorf("lineTime() = %v past the search limit, want no timestamp", got)
+	}
+}
+
+func TestLineTimeSyslog(t *testing.T) {
+	now := time.Now()
+	day := now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"plain", day.Format(time.Stamp) + " host sshd[42]: accepted"},
+		{"with priority", "<13>" + day.Format(time.Stamp) + " host app: started"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := lineTime([]byte(tt.line))
+			want := day.Truncate(time.Second)
+			if !ok || !got.Equal(want) {
+				t.Errorf("lineTime(%q) = %v, %v, want %v, true", tt.line, got, ok, want)
+			}
+		})
+	}
+}
+
+func TestWithRecentYear(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"earlier this year", now.Add(-time.Hour).AddDate(-now.Year(), 0, 0), now.Add(-time.Hour)},
+		{"within the clock skew", now.Add(time.Hour).AddDate(-now.Year(), 0, 0), now.Add(time.Hour)},
+		{"in the future", now.Add(48*time.Hour).AddDate(-now.Year(), 0, 0), now.Add(48*time.Hour).AddDate(-1, 0, 0)},
+	}
+	for _, tt := range tests {
+		if got := withRecentYear(tt.t); !got.Equal(tt.want) {
+			t.Errorf("%s: withRecentYear(%v) = %v, want %v", tt.name, tt.t, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package filesystem
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+
+	"github.com/fmotalleb/go-tools/log"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watchHub shares one filesystem watcher between the feeds of all followed
+// paths. It watches their directories, so renames and re-creations are seen
+// too, and wakes the subscriber of a path whenever an event names it.
+type watchHub struct {
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+	dirs    map[string]int
+	subs    map[string]map[chan struct{}]struct{}
+}
+
+// hub returns the process-wide watch hub, started on first use.
+var hub = sync.OnceValue(func() *watchHub {
+	h := &watchHub{
+		dirs: make(map[string]int),
+		subs: make(map[string]map[chan struct{}]struct{}),
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Of(context.Background()).Warn("file notifications unavailable, polling instead", zap.Error(err))
+		return h
+	}
+	h.watcher = w
+	go h.run()
+	return h
+})
+
+// subscribe returns a channel that receives a value whenever path may have changed,
+// and a function to unsubscribe. ok is false when the path can not be watched, in
+// which case the caller has to poll.
+func (h *watchHub) subscribe(path string) (<-chan struct{}, func(), bool) {
+	path = filepath.Clean(path)
+	dir := filepath.Dir(path)
+	if h.watcher == nil || !supportsNotify(dir) {
+		return nil, func() {}, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.dirs[dir] == 0 {
+		if err := h.watcher.Add(dir); err != nil {
+			log.Of(context.Background()).Warn("failed to watch directory, polling instead", zap.String("dir", dir), zap.Error(err))
+			return nil, func() {}, false
+		}
+	}
+	h.dirs[dir]++
+	ch := make(chan struct{}, 1)
+	if h.subs[path] == nil {
+		h.subs[path] = make(map[chan struct{}]struct{})
+	}
+	h.subs[path][ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() { h.unsubscribe(path, dir, ch) })
+	}, true
+}
+
+func (h *watchHub) unsubscribe(path, dir string, ch chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[path], ch)
+	if len(h.subs[path]) == 0 {
+		delete(h.subs, path)
+	}
+	h.dirs[dir]--
+	if h.dirs[dir] == 0 {
+		delete(h.dirs, dir)
+		// The directory may be gone already.
+		_ = h.watcher.Remove(dir)
+	}
+}
+
+// run fans out watcher events to the subscribers of the named paths.
+func (h *watchHub) run() {
+	logger := log.Of(context.Background()).Named("Watch")
+	for {
+		select {
+		case ev, ok := <-h.watcher.Events:
+			if !ok {
+				return
+			}
+			h.notify(filepath.Clean(ev.Name))
+		case err, ok := <-h.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("file watcher error", zap.Error(err))
+		}
+	}
+}
+
+// notify wakes the subscribers of path without blocking; pending wake-ups coalesce.
+func (h *watchHub) notify(path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[path] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
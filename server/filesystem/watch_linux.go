@@ -0,0 +1,25 @@
+//go:build linux
+
+package filesystem
+
+import "syscall"
+
+// Magic numbers of network and user-space filesystems whose changes made by
+// other hosts or processes are not reported by inotify.
+var noNotifyFilesystems = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517b:     true, // SMB
+	0xff534d42: true, // CIFS
+	0xfe534d42: true, // SMB2
+	0x65735546: true, // FUSE
+	0x01021997: true, // 9P
+}
+
+// supportsNotify reports whether changes in dir are reliably reported by inotify.
+func supportsNotify(dir string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return false
+	}
+	return !noNotifyFilesystems[uint32(st.Type)]
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package filesystem
+
+// supportsNotify reports whether changes in dir are reliably reported by the
+// platform's file notifications.
+func supportsNotify(string) bool {
+	return true
+}
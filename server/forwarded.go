@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseProxies parses trusted proxy addresses and CIDR ranges.
+func parseProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// isTrusted reports whether addr belongs to a trusted proxy.
+func isTrusted(proxies []netip.Prefix, addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range proxies {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// withForwarded is a middleware that honors the X-Forwarded-For and X-Forwarded-Host
+// headers of requests coming from trusted proxies. The client address becomes the
+// right-most untrusted entry of X-Forwarded-For. X-Forwarded-Proto, read later to
+// detect HTTPS, is removed from requests of other peers.
+func withForwarded(proxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if len(proxies) == 0 || err != nil || !isTrusted(proxies, host) {
+				r.Header.Del("X-Forwarded-Proto")
+				next.ServeHTTP(w, r)
+				return
+			}
+			if client := forwardedClient(proxies, r.Header.Values("X-Forwarded-For")); client != "" {
+				r.RemoteAddr = client
+			}
+			if fwdHost := r.Header.Get("X-Forwarded-Host"); fwdHost != "" {
+				r.Host = fwdHost
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClient returns the client address of X-Forwarded-For values.
+func forwardedClient(proxies []netip.Prefix, values []string) string {
+	var hops []string
+	for _, v := range values {
+		for hop := range strings.SplitSeq(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(hops[i]); err != nil {
+			return ""
+		}
+		if i == 0 || !isTrusted(proxies, hops[i]) {
+			return hops[i]
+		}
+	}
+	return ""
+}
@@ -1,10 +1,22 @@
 // Package helper provides helper functions for the server.
 package helper
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type ctxKey string
+
+const ctxPathKey ctxKey = "helper.path"
 
 // GetPath returns the path from the request.
+// If the path was resolved by WithPath, the resolved path is returned instead of the raw query.
 func GetPath(r *http.Request) (string, bool) {
+	if p, ok := r.Context().Value(ctxPathKey).(string); ok {
+		return p, true
+	}
 	queries := r.URL.Query()
 	if !queries.Has("path") {
 		return "", false
@@ -12,3 +24,14 @@ func GetPath(r *http.Request) (string, bool) {
 	reqPath := queries.Get("path")
 	return reqPath, true
 }
+
+// WithPath returns a shallow copy of r whose GetPath returns the given resolved path.
+func WithPath(r *http.Request, p string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ctxPathKey, p))
+}
+
+// GetFlag reports whether the boolean query parameter name is set to a truthy value.
+func GetFlag(r *http.Request, name string) bool {
+	v := strings.ToLower(r.URL.Query().Get(name))
+	return v == "1" || v == "true" || v == "yes"
+}
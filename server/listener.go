@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fmotalleb/timber/config"
+)
+
+const (
+	unixPrefix         = "unix://"
+	staleSocketTimeout = time.Second
+)
+
+// ErrorSocketInUse is returned when another process listens on a configured Unix socket.
+var ErrorSocketInUse = errors.New("unix socket is in use")
+
+// listener is a server bound to a configured address. Its handler can be
+// swapped while it serves.
+type listener struct {
+	server  *http.Server
+	cfg     config.Listener
+	tls     *tls.Config
+	ln      net.Listener
+	handler atomic.Pointer[http.Handler]
+	closed  atomic.Bool
+}
+
+// newListener returns an unbound listener of lc, serving HTTPS with tlsCfg
+// when it is set. Requests have ctx as their base context.
+func newListener(ctx context.Context, lc config.Listener, tlsCfg *tls.Config) *listener {
+	l := &listener{cfg: lc, tls: tlsCfg}
+	l.server = &http.Server{
+		ReadHeaderTimeout: readHeaderTimeout,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			(*l.handler.Load()).ServeHTTP(w, r)
+		}),
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+		TLSConfig: tlsCfg,
+	}
+	return l
+}
+
+// sameBinding reports whether listeners a and b are bound the same way,
+// differing at most in their auth requirements.
+func sameBinding(a, b config.Listener) bool {
+	a.Auth, a.User = nil, ""
+	b.Auth, b.User = nil, ""
+	return reflect.DeepEqual(a, b)
+}
+
+// listenerConfigs returns the configured listeners, or Listen when there are none.
+func listenerConfigs(cfg config.Config) []config.Listener {
+	if len(cfg.Listeners) > 0 {
+		return cfg.Listeners
+	}
+	return []config.Listener{{Address: cfg.Listen}}
+}
+
+// isUnix reports whether the listener is a Unix domain socket.
+func isUnix(cfg config.Listener) bool {
+	return strings.HasPrefix(cfg.Address, unixPrefix)
+}
+
+// listen binds the address.
+func (l *listener) listen() error {
+	path, ok := strings.CutPrefix(l.cfg.Address, unixPrefix)
+	if !ok {
+		ln, err := net.Listen("tcp", l.cfg.Address)
+		if err != nil {
+			return err
+		}
+		l.ln = ln
+		return nil
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	// Nobody may connect before the socket has its mode and owner.
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+	l.ln = ln
+	if err = setSocketPermissions(path, l.cfg); err != nil {
+		return err
+	}
+	return nil
+}
+
+// removeStaleSocket removes the socket at path when nothing listens on it any
+// more, as after an unclean exit. A socket still in use is an error.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	d := net.Dialer{Timeout: staleSocketTimeout}
+	conn, err := d.DialContext(context.Background(), "unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrorSocketInUse, path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		// Let listening report why the path can not be used.
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// serve serves requests until the listener is closed, which is not an error.
+func (l *listener) serve() error {
+	var err error
+	if l.tls != nil {
+		err = l.server.ServeTLS(l.ln, "", "")
+	} else {
+		err = l.server.Serve(l.ln)
+	}
+	if l.closed.Load() {
+		return http.ErrServerClosed
+	}
+	return err
+}
+
+// close stops accepting connections, leaving open ones to the server.
+func (l *listener) close() {
+	l.closed.Store(true)
+	l.ln.Close()
+}
+
+// setSocketPermissions applies the owner, group and file mode of a Unix socket.
+// The owner is set first, so that the mode never applies to the wrong group.
+func setSocketPermissions(path string, cfg config.Listener) error {
+	mode, err := strconv.ParseUint(cfg.Mode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid socket mode %q: %w", cfg.Mode, err)
+	}
+	if cfg.Owner != "" || cfg.Group != "" {
+		uid, gid := -1, -1
+		if cfg.Owner != "" {
+			if uid, err = lookupID(cfg.Owner, user.Lookup, func(u *user.User) string { return u.Uid }); err != nil {
+				return err
+			}
+		}
+		if cfg.Group != "" {
+			if gid, err = lookupID(cfg.Group, user.LookupGroup, func(g *user.Group) string { return g.Gid }); err != nil {
+				return err
+			}
+		}
+		if err = os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return os.Chmod(path, os.FileMode(mode))
+}
+
+// lookupID resolves a numeric ID or a user or group name to its ID.
+func lookupID[T any](name string, lookup func(string) (T, error), id func(T) string) (int, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		return n, nil
+	}
+	v, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id(v))
+}
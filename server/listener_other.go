@@ -0,0 +1,11 @@
+//go:build !unix
+
+package server
+
+import "net"
+
+// listenPrivate listens on the Unix socket path; there is no umask to restrict
+// it with until its mode is set.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
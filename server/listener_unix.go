@@ -0,0 +1,22 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// umaskMu serializes changes of the process umask.
+var umaskMu sync.Mutex
+
+// listenPrivate listens on the Unix socket path, created accessible to the
+// owner only.
+func listenPrivate(path string) (net.Listener, error) {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// combinedLine matches the combined log format of nginx and Apache, and the
+// common log format, which lacks the referer and user agent.
+var combinedLine = regexp.MustCompile(
+	`^(\S+) (\S+) (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`,
+)
+
+// combinedParser parses access logs in the combined or common log format.
+type combinedParser struct{}
+
+func (combinedParser) Name() string { return Combined }
+
+func (combinedParser) Parse(line []byte) (map[string]any, bool) {
+	m := combinedLine.FindSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	fields := map[string]any{
+		"remote_addr": string(m[1]),
+		"time":        string(m[4]),
+		"request":     string(m[5]),
+	}
+	setUnlessDash(fields, "ident", string(m[2]))
+	setUnlessDash(fields, "user", string(m[3]))
+	if parts := strings.Fields(string(m[5])); len(parts) == 3 {
+		fields["method"], fields["path"], fields["protocol"] = parts[0], parts[1], parts[2]
+	}
+	fields["status"], _ = strconv.Atoi(string(m[6]))
+	if n, err := strconv.ParseInt(string(m[7]), 10, 64); err == nil {
+		fields["bytes"] = n
+	}
+	if m[8] != nil {
+		setUnlessDash(fields, "referer", string(m[8]))
+		setUnlessDash(fields, "user_agent", string(m[9]))
+	}
+	return fields, true
+}
+
+// setUnlessDash sets the field unless its value is `-`, which stands for none.
+func setUnlessDash(fields map[string]any, key, value string) {
+	if value != "-" {
+		fields[key] = value
+	}
+}
@@ -0,0 +1,26 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// jsonParser parses JSON lines holding an object.
+type jsonParser struct{}
+
+func (jsonParser) Name() string { return JSON }
+
+func (jsonParser) Parse(line []byte) (map[string]any, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(line))
+	// Keep large integers, such as IDs, exact.
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil || dec.More() {
+		return nil, false
+	}
+	return fields, true
+}
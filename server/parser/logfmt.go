@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// logfmtParser parses `key=value` pairs separated by spaces, where values may
+// be double-quoted with Go escapes. A key without a value is set to true.
+type logfmtParser struct{}
+
+func (logfmtParser) Name() string { return Logfmt }
+
+func (logfmtParser) Parse(line []byte) (map[string]any, bool) {
+	fields, _, ok := parseLogfmt(line)
+	return fields, ok
+}
+
+// Detects reports whether line is made of `key=value` pairs only. A bare word
+// is a valid key, but lines such as `2024-05-01T10:00:00Z INFO user=alice`
+// would then pass for logfmt, so detection does not accept them.
+func (logfmtParser) Detects(line []byte) bool {
+	_, bare, ok := parseLogfmt(line)
+	return ok && bare == 0
+}
+
+// parseLogfmt returns the fields of line and the number of keys without a value.
+// It fails for lines without any `key=value` pair.
+func parseLogfmt(line []byte) (map[string]any, int, bool) {
+	s := strings.TrimSpace(string(line))
+	fields := make(map[string]any)
+	pairs, bare := 0, 0
+	for s != "" {
+		end := strings.IndexAny(s, "= ")
+		if end == 0 {
+			return nil, 0, false
+		}
+		if end < 0 || s[end] == ' ' {
+			key := s
+			if end >= 0 {
+				key, s = s[:end], s[end:]
+			} else {
+				s = ""
+			}
+			fields[key] = true
+			bare++
+			s = strings.TrimLeft(s, " ")
+			continue
+		}
+		key := s[:end]
+		value, rest, ok := logfmtValue(s[end+1:])
+		if !ok {
+			return nil, 0, false
+		}
+		fields[key] = value
+		pairs++
+		s = strings.TrimLeft(rest, " ")
+	}
+	if pairs == 0 {
+		return nil, 0, false
+	}
+	return fields, bare, true
+}
+
+// logfmtValue reads a value, quoted or not, from the start of s.
+func logfmtValue(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexByte(s, ' ')
+		if end < 0 {
+			end = len(s)
+		}
+		value := s[:end]
+		if strings.ContainsAny(value, `="`) {
+			return "", "", false
+		}
+		return value, s[end:], true
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil || (i+1 < len(s) && s[i+1] != ' ') {
+				return "", "", false
+			}
+			return value, s[i+1:], true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,94 @@
+// Package parser parses log lines into structured fields.
+package parser
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Names of the built-in parsers.
+const (
+	JSON     = "json"
+	Logfmt   = "logfmt"
+	Combined = "combined"
+	Syslog   = "syslog"
+	Regex    = "regex"
+	// Auto detects the parser from the first lines of a file.
+	Auto = "auto"
+)
+
+// DetectLines is the number of lines auto-detection looks at.
+const DetectLines = 20
+
+var (
+	// ErrorUnknownParser is returned for a parser name that is not built in.
+	ErrorUnknownParser = errors.New("unknown parser")
+	// ErrorMissingPattern is returned when the regex parser has no pattern.
+	ErrorMissingPattern = errors.New("the regex parser requires a pattern")
+)
+
+// Parser parses a log line into fields.
+type Parser interface {
+	// Name returns the name of the parser.
+	Name() string
+	// Parse returns the fields of line, or false when the line is not in the
+	// format of the parser.
+	Parse(line []byte) (map[string]any, bool)
+}
+
+// detector is implemented by parsers that are stricter about the lines they
+// accept during auto-detection than when they are chosen.
+type detector interface {
+	Detects(line []byte) bool
+}
+
+// detectable are the parsers auto-detection chooses from, by priority:
+// logfmt comes last as any line with a `key=value` pair is valid logfmt.
+var detectable = []Parser{jsonParser{}, syslogParser{}, combinedParser{}, logfmtParser{}}
+
+// New returns the built-in parser name. The regex parser extracts the named
+// groups of pattern. An empty name or Auto returns nil, to be detected with Detect.
+func New(name, pattern string) (Parser, error) {
+	switch name {
+	case "", Auto:
+		return nil, nil
+	case Regex:
+		return newRegexParser(pattern)
+	}
+	for _, p := range detectable {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrorUnknownParser, name)
+}
+
+// Detect returns the parser that parses the most of the sample lines, or nil
+// when none parses any. Only the first lines of the sample are looked at, and
+// only lines made of `key=value` pairs count for logfmt.
+func Detect(sample [][]byte) Parser {
+	sample = sample[:min(len(sample), DetectLines)]
+	var best Parser
+	bestCount := 0
+	for _, p := range detectable {
+		count := 0
+		for _, line := range sample {
+			if detects(p, line) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = p, count
+		}
+	}
+	return best
+}
+
+// detects reports whether line counts for p during auto-detection.
+func detects(p Parser, line []byte) bool {
+	if d, ok := p.(detector); ok {
+		return d.Detects(line)
+	}
+	_, ok := p.Parse(line)
+	return ok
+}
@@ -0,0 +1,296 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type parseTest struct {
+	name string
+	line string
+	want map[string]any
+	ok   bool
+}
+
+func runParseTests(t *testing.T, p Parser, tests []parseTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := p.Parse([]byte(tt.line))
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s.Parse(%q) = %#v, %v, want %#v, %v", p.Name(), tt.line, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestJSONParser(t *testing.T) {
+	runParseTests(t, jsonParser{}, []parseTest{
+		{
+			"object",
+			`{"level":"info","msg":"started","id":12345678901234567890,"ok":true}`,
+			map[string]any{"level": "info", "msg": "started", "id": json.Number("12345678901234567890"), "ok": true},
+			true,
+		},
+		{"nested", ` {"req":{"path":"/"}} `, map[string]any{"req": map[string]any{"path": "/"}}, true},
+		{"array", `["a"]`, nil, false},
+		{"trailing data", `{"a":1} {"b":2}`, nil, false},
+		{"truncated", `{"a":`, nil, false},
+		{"text", "level=info", nil, false},
+		{"empty", "", nil, false},
+	})
+}
+
+func TestLogfmtParser(t *testing.T) {
+	runParseTests(t, logfmtParser{}, []parseTest{
+		{
+			"pairs",
+			`level=info msg="request done" path=/api status=200`,
+			map[string]any{"level": "info", "msg": "request done", "path": "/api", "status": "200"},
+			true,
+		},
+		{"escaped quote", `msg="say \"hi\"" level=warn`, map[string]any{"msg": `say "hi"`, "level": "warn"}, true},
+		{"empty value", `a= b=1`, map[string]any{"a": "", "b": "1"}, true},
+		{"bare key", `debug level=info`, map[string]any{"debug": true, "level": "info"}, true},
+		{"extra spaces", `  a=1   b=2  `, map[string]any{"a": "1", "b": "2"}, true},
+		{"only bare words", `hello world`, nil, false},
+		{"missing key", `=1 a=2`, nil, false},
+		{"unterminated quote", `msg="oops level=info`, nil, false},
+		{"quote in value", `a=b"c`, nil, false},
+		{"text after quote", `msg="a"b c=d`, nil, false},
+		{"empty", "", nil, false},
+	})
+}
+
+func TestLogfmtDetects(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{`level=info msg="request done"`, true},
+		{`debug level=info`, false},
+		{`2024-05-01T10:00:00Z INFO user=alice logged in`, false},
+		{`hello world`, false},
+	}
+	for _, tt := range tests {
+		if got := (logfmtParser{}).Detects([]byte(tt.line)); got != tt.want {
+			t.Errorf("Detects(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCombinedParser(t *testing.T) {
+	runParseTests(t, combinedParser{}, []parseTest{
+		{
+			"combined",
+			`203.0.113.7 - alice [01/May/2024:10:00:00 +0000] "GET /index.html HTTP/1.1" 200 512 "https://example.com/" "curl/8.0"`,
+			map[string]any{
+				"remote_addr": "203.0.113.7",
+				"user":        "alice",
+				"time":        "01/May/2024:10:00:00 +0000",
+				"request":     "GET /index.html HTTP/1.1",
+				"method":      "GET",
+				"path":        "/index.html",
+				"protocol":    "HTTP/1.1",
+				"status":      200,
+				"bytes":       int64(512),
+				"referer":     "https://example.com/",
+				"user_agent":  "curl/8.0",
+			},
+			true,
+		},
+		{
+			"common without bytes",
+			`203.0.113.7 - - [01/May/2024:10:00:00 +0000] "GET / HTTP/1.1" 304 -`,
+			map[string]any{
+				"remote_addr": "203.0.113.7",
+				"time":        "01/May/2024:10:00:00 +0000",
+				"request":     "GET / HTTP/1.1",
+				"method":      "GET",
+				"path":        "/",
+				"protocol":    "HTTP/1.1",
+				"status":      304,
+			},
+			true,
+		},
+		{
+			"malformed request and no referer",
+			`203.0.113.7 - - [01/May/2024:10:00:00 +0000] "\x16\x03" 400 0 "-" "-"`,
+			map[string]any{
+				"remote_addr": "203.0.113.7",
+				"time":        "01/May/2024:10:00:00 +0000",
+				"request":     `\x16\x03`,
+				"status":      400,
+				"bytes":       int64(0),
+			},
+			true,
+		},
+		{"not an access log", "level=info msg=started", nil, false},
+	})
+}
+
+func TestSyslogParser(t *testing.T) {
+	runParseTests(t, syslogParser{}, []parseTest{
+		{
+			"rfc5424",
+			`<165>1 2024-05-01T10:00:00.003Z host app 1234 ID47 [exampleSDID@32473 iut="3"] started`,
+			map[string]any{
+				"priority":        165,
+				"facility":        20,
+				"severity":        5,
+				"version":         1,
+				"timestamp":       "2024-05-01T10:00:00.003Z",
+				"hostname":        "host",
+				"app_name":        "app",
+				"procid":          "1234",
+				"msgid":           "ID47",
+				"structured_data": `[exampleSDID@32473 iut="3"]`,
+				"message":         "started",
+			},
+			true,
+		},
+		{
+			"rfc5424 nil values and bom",
+			"<34>1 2024-05-01T10:00:00Z host app - - - \ufeffstarted",
+			map[string]any{
+				"priority":  34,
+				"facility":  4,
+				"severity":  2,
+				"version":   1,
+				"timestamp": "2024-05-01T10:00:00Z",
+				"hostname":  "host",
+				"app_name":  "app",
+				"message":   "started",
+			},
+			true,
+		},
+		{
+			"rfc3164",
+			`<13>May  1 10:00:00 host sshd[42]: Accepted publickey`,
+			map[string]any{
+				"priority":  13,
+				"facility":  1,
+				"severity":  5,
+				"timestamp": "May  1 10:00:00",
+				"hostname":  "host",
+				"app_name":  "sshd",
+				"procid":    "42",
+				"message":   "Accepted publickey",
+			},
+			true,
+		},
+		{
+			"rfc3164 without priority and pid, iso timestamp",
+			`2024-05-01T10:00:00+02:00 host kernel: eth0 up`,
+			map[string]any{
+				"timestamp": "2024-05-01T10:00:00+02:00",
+				"hostname":  "host",
+				"app_name":  "kernel",
+				"message":   "eth0 up",
+			},
+			true,
+		},
+		{"not syslog", "level=info msg=started", nil, false},
+	})
+}
+
+func TestRegexParser(t *testing.T) {
+	p, err := New(Regex, `^(?P<level>[A-Z]+) (?P<msg>.*?)(?: \((?P<code>\d+)\))?$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runParseTests(t, p, []parseTest{
+		{"all groups", "ERROR disk full (28)", map[string]any{"level": "ERROR", "msg": "disk full", "code": "28"}, true},
+		{"unmatched group", "INFO started", map[string]any{"level": "INFO", "msg": "started"}, true},
+		{"no match", "started", nil, false},
+	})
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		wantName string
+		wantErr  error
+	}{
+		{"", "", "", nil},
+		{Auto, "", "", nil},
+		{JSON, "", JSON, nil},
+		{Logfmt, "", Logfmt, nil},
+		{Combined, "", Combined, nil},
+		{Syslog, "", Syslog, nil},
+		{Regex, `(?P<a>.)`, Regex, nil},
+		{Regex, "", "", ErrorMissingPattern},
+		{"xml", "", "", ErrorUnknownParser},
+	}
+	for _, tt := range tests {
+		p, err := New(tt.name, tt.pattern)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("New(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got := parserName(p); got != tt.wantName {
+			t.Errorf("New(%q) = %q, want %q", tt.name, got, tt.wantName)
+		}
+	}
+	for _, pattern := range []string{"(", "no groups"} {
+		if _, err := New(Regex, pattern); err == nil {
+			t.Errorf("New(regex, %q) error = nil, want an error", pattern)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample []string
+		want   string
+	}{
+		{"json", []string{`{"level":"info"}`, `{"level":"warn"}`}, JSON},
+		{"logfmt", []string{"level=info msg=a", "level=warn msg=b"}, Logfmt},
+		{"combined", []string{`1.2.3.4 - - [01/May/2024:10:00:00 +0000] "GET / HTTP/1.1" 200 5`}, Combined},
+		{"syslog", []string{"<13>May  1 10:00:00 host app: started"}, Syslog},
+		{"mostly json", []string{`{"a":1}`, "level=info", `{"a":2}`}, JSON},
+		{"json before logfmt on a tie", []string{`{"a":1}`, "level=info"}, JSON},
+		{
+			"iso timestamps are not logfmt",
+			[]string{"2024-05-01T10:00:00Z INFO user=alice logged in", "2024-05-01T10:00:01Z WARN user=bob slow"},
+			"",
+		},
+		{"plain text", []string{"started", "stopped"}, ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sample := make([][]byte, len(tt.sample))
+			for i, line := range tt.sample {
+				sample[i] = []byte(line)
+			}
+			if got := parserName(Detect(sample)); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectLooksAtFirstLines(t *testing.T) {
+	var sample [][]byte
+	for range DetectLines {
+		sample = append(sample, []byte("level=info"))
+	}
+	for range 2 * DetectLines {
+		sample = append(sample, []byte(`{"a":1}`))
+	}
+	if got := parserName(Detect(sample)); got != Logfmt {
+		t.Errorf("Detect() = %q, want %q", got, Logfmt)
+	}
+}
+
+func parserName(p Parser) string {
+	if p == nil {
+		return ""
+	}
+	return p.Name()
+}
@@ -0,0 +1,51 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// regexParser extracts the named groups of a user-defined RE2 regular expression.
+type regexParser struct {
+	re *regexp.Regexp
+}
+
+func newRegexParser(pattern string) (Parser, error) {
+	if pattern == "" {
+		return nil, ErrorMissingPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parser pattern: %w", err)
+	}
+	if !hasNamedGroup(re) {
+		return nil, errors.New("the parser pattern has no named groups")
+	}
+	return regexParser{re: re}, nil
+}
+
+func hasNamedGroup(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (regexParser) Name() string { return Regex }
+
+func (p regexParser) Parse(line []byte) (map[string]any, bool) {
+	m := p.re.FindSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	fields := make(map[string]any)
+	for i, name := range p.re.SubexpNames() {
+		if name != "" && m[i] != nil {
+			fields[name] = string(m[i])
+		}
+	}
+	return fields, true
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// RFC 5424: <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG].
+	rfc5424Line = regexp.MustCompile(
+		`^<(\d{1,3})>(\d{1,2}) (\S+) (\S+) (\S+) (\S+) (\S+) (-|(?:\[(?:[^\]\\]|\\.)*\])+)(?: (.*))?$`,
+	)
+	// RFC 3164: [<PRI>]TIMESTAMP HOSTNAME TAG[PID]: MSG, also with the ISO timestamps
+	// of modern syslog daemons.
+	rfc3164Line = regexp.MustCompile(
+		`^(?:<(\d{1,3})>)?([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) (\S+) ([^\s:\[]+)(?:\[([^\]]*)\])?: ?(.*)$`,
+	)
+)
+
+// facilityShift splits a syslog priority into its facility and severity.
+const facilityShift = 3
+
+// syslogParser parses RFC 5424 and RFC 3164 (BSD) syslog lines.
+type syslogParser struct{}
+
+func (syslogParser) Name() string { return Syslog }
+
+func (syslogParser) Parse(line []byte) (map[string]any, bool) {
+	if m := rfc5424Line.FindSubmatch(line); m != nil {
+		fields := map[string]any{"version": atoi(m[2])}
+		setPriority(fields, m[1])
+		for i, key := range []string{"timestamp", "hostname", "app_name", "procid", "msgid", "structured_data"} {
+			setUnlessDash(fields, key, string(m[i+3]))
+		}
+		// The message may start with a byte order mark to declare UTF-8.
+		fields["message"] = strings.TrimPrefix(string(m[9]), "\ufeff")
+		return fields, true
+	}
+	if m := rfc3164Line.FindSubmatch(line); m != nil {
+		fields := map[string]any{
+			"timestamp": string(m[2]),
+			"hostname":  string(m[3]),
+			"app_name":  string(m[4]),
+			"message":   string(m[6]),
+		}
+		setPriority(fields, m[1])
+		if m[5] != nil {
+			fields["procid"] = string(m[5])
+		}
+		return fields, true
+	}
+	return nil, false
+}
+
+// setPriority sets the priority, facility and severity fields, when the line has a priority.
+func setPriority(fields map[string]any, pri []byte) {
+	if pri == nil {
+		return
+	}
+	p := atoi(pri)
+	fields["priority"] = p
+	fields["facility"] = p >> facilityShift
+	fields["severity"] = p & (1<<facilityShift - 1)
+}
+
+func atoi(b []byte) int {
+	n, _ := strconv.Atoi(string(b))
+	return n
+}
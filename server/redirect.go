@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+const httpsPort = "443"
+
+// redirectToHTTPS redirects every request to the same URL on the HTTPS listener at listen.
+func redirectToHTTPS(listen string) http.Handler {
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		port = httpsPort
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		target := net.JoinHostPort(strings.Trim(host, "[]"), port)
+		if port == httpsPort {
+			target = strings.TrimSuffix(target, ":"+httpsPort)
+		}
+		http.Redirect(w, r, "https://"+target+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
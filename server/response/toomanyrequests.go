@@ -0,0 +1,14 @@
+package response
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TooManyRequests writes a too many requests response with a Retry-After header to the client.
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, "too many failed attempts, try again later", http.StatusTooManyRequests)
+}
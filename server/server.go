@@ -2,44 +2,344 @@ package server
 
 import (
 	"context"
-	"embed"
+	"crypto/tls"
 	"encoding/json"
-	"io/fs"
-	"net"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/netip"
+	"reflect"
+	"slices"
 	"time"
 
 	"github.com/fmotalleb/go-tools/log"
 	"go.uber.org/zap"
 
+	"github.com/fmotalleb/timber/config"
 	"github.com/fmotalleb/timber/server/auth"
 	"github.com/fmotalleb/timber/server/filesystem"
+	"github.com/fmotalleb/timber/server/parser"
 
 	"github.com/go-chi/chi/v5"
 )
 
-//go:embed static/*
-var staticFS embed.FS
+const (
+	readHeaderTimeout = 3 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// Server serves the configured listeners and applies reloaded configurations
+// to them. Listeners whose address and TLS settings did not change stay open
+// across reloads and switch to the routes of the new configuration, so their
+// connections, including follow streams, are kept. Open requests are ended
+// only when the access configuration changed, so that no stream keeps running
+// with permissions that were revoked.
+type Server struct {
+	ctx       context.Context
+	errCh     chan error
+	listeners []*listener
+	tls       *serverTLS
+	limiter   *auth.Limiter
+
+	access     accessConfig
+	streams    context.Context
+	endStreams context.CancelFunc
+}
 
-const readHeaderTimeout = 3 * time.Second
+// NewServer returns a server with no listeners. Requests are served with ctx,
+// which carries the logger, as their base context.
+func NewServer(ctx context.Context) *Server {
+	return &Server{
+		ctx:   context.WithoutCancel(ctx),
+		errCh: make(chan error, 1),
+	}
+}
 
-// Serve starts the HTTP server.
-func Serve(ctx Context) error {
+// Serve applies the configuration of ctx and serves it until ctx is done,
+// e.g. on reload, leaving the listeners open for the next configuration.
+// It returns the first error of a listener.
+func (s *Server) Serve(ctx Context) error {
 	l := log.Of(ctx).Named("Serve")
 	l.Info("starting server")
+	if err := s.apply(ctx, ctx.GetCfg()); err != nil {
+		return err
+	}
+	select {
+	case err := <-s.errCh:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// Close closes the listeners and waits up to shutdownTimeout for open
+// requests to finish before closing their connections.
+func (s *Server) Close() {
+	if s.endStreams != nil {
+		s.endStreams()
+	}
+	if s.tls != nil {
+		s.tls.stop()
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, shutdownTimeout)
+	defer cancel()
+	for _, ln := range s.listeners {
+		if err := ln.server.Shutdown(ctx); err != nil {
+			ln.server.Close()
+		}
+	}
+}
+
+// apply switches the server to cfg. Listeners that are no longer configured,
+// or whose address or TLS settings changed, stop accepting connections but
+// finish their open requests.
+func (s *Server) apply(ctx Context, cfg config.Config) error {
+	l := log.Of(ctx).Named("Serve")
+	// Lockouts are kept across reloads.
+	if s.limiter == nil {
+		s.limiter = auth.NewLimiter(cfg.Lockout)
+	} else {
+		s.limiter.SetConfig(cfg.Lockout)
+	}
+	rt, err := newRoutes(ctx, cfg, s.limiter)
+	if err != nil {
+		return err
+	}
+	tlsCfg, err := s.applyTLS(ctx, cfg.TLS)
+	if err != nil {
+		return err
+	}
+	s.applyAccess(ctx, cfg)
+	next, err := s.nextListeners(rt, cfg, tlsCfg)
+	if err != nil {
+		return err
+	}
+
+	for _, ln := range s.listeners {
+		if !slices.Contains(next, ln) {
+			ln.close()
+			go func() {
+				// Open requests end on their own, or when the access changes.
+				_ = ln.server.Shutdown(s.ctx)
+			}()
+		}
+	}
+	s.listeners = next
+	for _, ln := range next {
+		if ln.ln != nil {
+			continue
+		}
+		if err = ln.listen(); err != nil {
+			return err
+		}
+		l.Info("listening", zap.String("address", ln.cfg.Address))
+		go s.serve(ln)
+	}
+	return nil
+}
+
+// nextListeners returns the listeners of cfg, reusing the open ones that are
+// bound the same way, plus the HTTP-to-HTTPS redirect listener when one is
+// configured.
+func (s *Server) nextListeners(rt *routes, cfg config.Config, tlsCfg *tls.Config) ([]*listener, error) {
+	next := make([]*listener, 0, len(cfg.Listeners)+1)
+	httpsAddr := ""
+	for _, lc := range listenerConfigs(cfg) {
+		handler, err := rt.handler(lc)
+		if err != nil {
+			return nil, err
+		}
+		var lnTLS *tls.Config
+		if tlsCfg != nil && !lc.Plaintext && !isUnix(lc) {
+			lnTLS = tlsCfg
+			if httpsAddr == "" {
+				httpsAddr = lc.Address
+			}
+		}
+		next = append(next, s.listenerFor(lc, lnTLS, handler))
+	}
+	if httpsAddr != "" && cfg.TLS.RedirectListen != "" {
+		lc := config.Listener{Address: cfg.TLS.RedirectListen}
+		next = append(next, s.listenerFor(lc, nil, redirectToHTTPS(httpsAddr)))
+	}
+	return next, nil
+}
+
+// serve serves ln until it is closed, reporting its error to Serve.
+func (s *Server) serve(ln *listener) {
+	if err := ln.serve(); !errors.Is(err, http.ErrServerClosed) {
+		select {
+		case s.errCh <- err:
+		default:
+		}
+	}
+}
+
+// listenerFor returns the open listener bound like lc with tlsCfg, or a new
+// unbound one, set to serve handler.
+func (s *Server) listenerFor(lc config.Listener, tlsCfg *tls.Config, handler http.Handler) *listener {
+	handler = endWith(s.streams, handler)
+	for _, ln := range s.listeners {
+		if ln.ln != nil && ln.tls == tlsCfg && sameBinding(ln.cfg, lc) {
+			ln.cfg = lc
+			ln.handler.Store(&handler)
+			return ln
+		}
+	}
+	ln := newListener(s.ctx, lc, tlsCfg)
+	ln.handler.Store(&handler)
+	return ln
+}
+
+// applyTLS returns the TLS configuration of cfg. When only the certificate
+// files changed, the running configuration is kept and the certificate is
+// reloaded in place, so HTTPS listeners stay open.
+func (s *Server) applyTLS(ctx Context, cfg config.TLS) (*tls.Config, error) {
+	if s.tls != nil && reflect.DeepEqual(s.tls.cfg, cfg) {
+		s.tls.reload(ctx)
+		return s.tls.config, nil
+	}
+	if s.tls != nil {
+		s.tls.stop()
+		s.tls = nil
+	}
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	t, err := newServerTLS(s.ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.tls = t
+	return t.config, nil
+}
+
+// accessConfig is the part of the configuration that decides who may read what.
+type accessConfig struct {
+	Users       []config.User
+	Tokens      []config.Token
+	ClientCerts []config.ClientCert
+	Access      map[string]config.Access
+	Session     config.Session
+	OIDC        config.OIDC
+	Listeners   []config.Listener
+}
+
+// applyAccess ends the open requests when the access configuration of cfg
+// differs from the one they were authorized with.
+func (s *Server) applyAccess(ctx Context, cfg config.Config) {
+	access := accessConfig{
+		Users:       cfg.Users,
+		Tokens:      cfg.Tokens,
+		ClientCerts: cfg.ClientCerts,
+		Access:      cfg.Access,
+		Session:     cfg.Session,
+		OIDC:        cfg.OIDC,
+		Listeners:   listenerConfigs(cfg),
+	}
+	if s.streams != nil && reflect.DeepEqual(access, s.access) {
+		return
+	}
+	if s.endStreams != nil {
+		log.Of(ctx).Named("Serve").Info("access configuration changed, ending open requests")
+		s.endStreams()
+	}
+	s.access = access
+	s.streams, s.endStreams = context.WithCancel(s.ctx)
+}
+
+// endWith cancels the requests served by next when ctx is done.
+func endWith(ctx context.Context, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		stop := context.AfterFunc(ctx, cancel)
+		defer stop()
+		next.ServeHTTP(w, r.WithContext(rctx))
+	})
+}
+
+// routes holds the state shared by the routers of all listeners.
+type routes struct {
+	ctx      Context
+	cfg      config.Config
+	prefix   string
+	proxies  []netip.Prefix
+	sessions *auth.Sessions
+	limiter  *auth.Limiter
+	oidc     *auth.OIDC
+}
+
+func newRoutes(ctx Context, cfg config.Config, limiter *auth.Limiter) (*routes, error) {
+	proxies, err := parseProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	for name, a := range cfg.Access {
+		allow, deny := a.Patterns()
+		if err = auth.ValidatePatterns(append(allow, deny...)...); err != nil {
+			return nil, fmt.Errorf("access %q: %w", name, err)
+		}
+		if err = auth.ValidateOps(a.Ops); err != nil {
+			return nil, fmt.Errorf("access %q: %w", name, err)
+		}
+		if _, err = parser.New(a.Parser, a.Pattern); err != nil {
+			return nil, fmt.Errorf("access %q: %w", name, err)
+		}
+	}
+	rt := &routes{
+		ctx:      ctx,
+		cfg:      cfg,
+		prefix:   cfg.Prefix(),
+		proxies:  proxies,
+		sessions: auth.NewSessions(cfg.Session, cfg.Prefix()),
+		limiter:  limiter,
+	}
+	if cfg.OIDC.Enabled() {
+		rt.oidc = auth.NewOIDC(ctx, cfg.OIDC, rt.sessions)
+	}
+	return rt, nil
+}
+
+// handler builds the HTTP handler of a listener, applying its auth requirements.
+func (rt *routes) handler(lc config.Listener) (http.Handler, error) {
+	cfg, sessions, limiter := rt.cfg, rt.sessions, rt.limiter
+	trusted := func(next http.Handler) http.Handler { return next }
+	if lc.User != "" {
+		var err error
+		if trusted, err = auth.WithTrustedUser(cfg, lc.User); err != nil {
+			return nil, err
+		}
+	}
 	r := chi.NewRouter()
 	r.Use(
-		withLogger(ctx),
+		withForwarded(rt.proxies),
+		withLogger(rt.ctx),
+		trusted,
 	)
 
 	// r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 	// 	w.Write([]byte("welcome"))
 	// })
+
+	// Login routes
+	if rt.oidc != nil {
+		r.Get("/auth/oidc/login", rt.oidc.Login)
+		r.Get("/auth/oidc/callback", rt.oidc.Callback)
+	}
+	r.With(auth.WithSession(cfg, sessions)).Get("/auth/status", auth.Status(cfg))
+	// Browsers may only log in and out from the same origin.
+	sameOrigin := http.NewCrossOriginProtection().Handler
+	r.With(sameOrigin).Post("/login", auth.Login(cfg, sessions, limiter))
+	r.With(sameOrigin).Post("/logout", auth.Logout(sessions))
+
 	// Authenticated routes
 	r.Group(func(r chi.Router) {
 		r.Use(
-			auth.WithBasicAuth(ctx.GetCfg()),
-			auth.PermissionCheck,
+			auth.WithClientCert(cfg),
+			auth.WithBearerToken(cfg, limiter),
+			auth.WithBasicAuth(cfg, sessions, limiter),
+			auth.RestrictMethods(lc.Auth),
 		)
 		r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
 			user, ok := auth.UserFromContext(r.Context())
@@ -51,45 +351,42 @@ func Serve(ctx Context) error {
 				log.Of(r.Context()).Error("failed to write response", zap.Error(err))
 			}
 		})
-		r.Get(
+		r.With(auth.PermissionCheck(auth.Static(auth.OpLs))).Get(
 			"/filesystem/ls",
 			filesystem.Ls,
 		)
-		r.Get(
+		r.With(auth.PermissionCheck(auth.WithFlag(auth.OpCat, "download", auth.OpDownload))).Get(
 			"/filesystem/cat",
 			filesystem.Cat,
 		)
-		r.Get(
+		r.With(auth.PermissionCheck(auth.Static(auth.OpHead))).Get(
 			"/filesystem/head",
 			filesystem.Head,
 		)
-		r.Get(
+		r.With(auth.PermissionCheck(auth.WithFlag(auth.OpTail, "follow", auth.OpFollow))).Get(
 			"/filesystem/tail",
 			filesystem.Tail,
 		)
+		r.With(auth.PermissionCheck(auth.Static(auth.OpRange))).Get(
+			"/filesystem/range",
+			filesystem.Range,
+		)
+		r.With(auth.PermissionCheck(auth.Static(auth.OpGrep))).Get(
+			"/filesystem/grep",
+			filesystem.Grep,
+		)
+		r.With(auth.PermissionCheck(auth.Static(auth.OpParse))).Get(
+			"/filesystem/parse",
+			filesystem.Parse,
+		)
+		r.Get("/filesystem/search", filesystem.Search)
+		r.Get("/filesystem/merge", filesystem.Merge)
+		r.Get("/filesystem/stream", filesystem.Stream)
 	})
-	rootFs, err := fs.Sub(staticFS, "static")
+	static, err := staticHandler(rt.prefix)
 	if err != nil {
-		return err
-	}
-	r.Mount("/", http.FileServerFS(rootFs))
-	server := &http.Server{
-		Addr:              ctx.GetCfg().Listen,
-		ReadHeaderTimeout: readHeaderTimeout,
-		Handler:           r,
-		BaseContext: func(_ net.Listener) context.Context {
-			return ctx
-		},
-	}
-	errCh := make(chan error, 1)
-
-	go func() {
-		errCh <- server.ListenAndServe()
-	}()
-	select {
-	case err := <-errCh:
-		return err
-	case <-ctx.Done():
-		return server.Shutdown(ctx)
+		return nil, err
 	}
+	r.Mount("/", static)
+	return withBasePath(rt.prefix, r), nil
 }
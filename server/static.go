@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"embed"
+	"html"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+)
+
+//go:embed static/*
+var staticFS embed.FS
+
+// staticHandler serves the embedded UI. The index page gets a <base> element
+// with the base path, so the UI resolves its relative URLs against it.
+func staticHandler(prefix string) (http.Handler, error) {
+	rootFs, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		return nil, err
+	}
+	index, err := fs.ReadFile(rootFs, "index.html")
+	if err != nil {
+		return nil, err
+	}
+	base := `<head>
+      <base href="` + html.EscapeString(prefix) + `/" />`
+	index = bytes.Replace(index, []byte("<head>"), []byte(base), 1)
+	files := http.FileServerFS(rootFs)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if _, err := w.Write(index); err != nil {
+			log.Of(r.Context()).Error("failed to write response", zap.Error(err))
+		}
+	}), nil
+}
+
+// withBasePath serves next under prefix, stripping it from the request path.
+// The bare prefix is redirected to prefix + "/" and other paths are not found.
+func withBasePath(prefix string, next http.Handler) http.Handler {
+	if prefix == "" {
+		return next
+	}
+	strip := http.StripPrefix(prefix, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == prefix:
+			target := prefix + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, prefix+"/"):
+			strip.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
@@ -1,4 +1,3 @@
-let AUTH_HEADER = null;
 let tailInterval = null;
 
 // --- DOM Elements ---
@@ -41,12 +40,13 @@ function hideLoader() {
 }
 
 async function authFetch(url) {
-    const res = await fetch(url, {
-        headers: {
-            "Authorization": AUTH_HEADER
-        }
-    });
+    // Authenticated by the session cookie issued on login
+    const res = await fetch(url);
 
+    if (res.status === 401) {
+        // Session expired or logged out elsewhere
+        showLogin();
+    }
     if (!res.ok) {
         throw new Error(res.status + " " + res.statusText);
     }
@@ -140,31 +140,47 @@ async function login() {
     const user = document.getElementById("user").value;
     const pass = document.getElementById("pass").value;
 
-    AUTH_HEADER = "Basic " + btoa(user + ":" + pass);
-
-
     try {
-        await authFetch("./filesystem/ls");
-
-        localStorage.setItem("auth_user", user);
-        localStorage.setItem("auth_pass", pass);
+        const res = await fetch("./login", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ username: user, password: pass }),
+        });
+        if (!res.ok) {
+            throw new Error(res.status + " " + res.statusText);
+        }
+        document.getElementById("pass").value = "";
+        document.getElementById("login-error").textContent = "";
+        showApp();
+    } catch (e) {
+        document.getElementById("login-error").textContent = "Authentication failed";
+    }
+}
 
-        document.getElementById("login").classList.add("hidden");
-        document.getElementById("app").classList.remove("hidden");
+function showApp() {
+    document.getElementById("login").classList.add("hidden");
+    document.getElementById("app").classList.remove("hidden");
+    loadFiles();
+}
 
-        loadFiles();
+async function loadAuthStatus() {
+    try {
+        const res = await fetch("./auth/status");
+        return await res.json();
     } catch (e) {
-        document.getElementById("login-error").textContent = "Authentication failed";
-        AUTH_HEADER = null;
+        return { oidc: false, user: null };
     }
 }
 
-function logout() {
-    localStorage.removeItem("auth_user");
-    localStorage.removeItem("auth_pass");
-    AUTH_HEADER = null;
+function showLogin() {
     document.getElementById("login").classList.remove("hidden");
     document.getElementById("app").classList.add("hidden");
+}
+
+function logout() {
+    stopFollow();
+    fetch("./logout", { method: "POST" }).catch(() => {});
+    showLogin();
     filesContainer.innerHTML = "";
     output.innerHTML = "";
 }
@@ -175,7 +191,7 @@ function filterFiles() {
     const filterText = document.getElementById("file-filter").value.toLowerCase();
 
     function recursiveFilter(node) {
-        const nodeNameEl = node.querySelector(":scope > .node-info > .node-name, :scope > .node-name");
+        const nodeNameEl = node.querySelector(":scope > .node-info > .node-name, :scope > .node-name, :scope > .file > .node-name");
         if (!nodeNameEl) return false;
         
         const nodeName = nodeNameEl.textContent.toLowerCase();
@@ -196,7 +212,7 @@ function filterFiles() {
 
         if (hasVisibleChild && !selfMatches && filterText) {
             childrenContainer.classList.add("open");
-            const clickable = node.querySelector(":scope > .node-info > .node-name, :scope > .node-name");
+            const clickable = node.querySelector(":scope > .node-info > .node-name, :scope > .node-name, :scope > .file > .node-name");
             if (clickable) {
                clickable.classList.add("open");
             }
@@ -258,6 +274,8 @@ function createNode(node) {
     } else { // It's a file
         nodeEl.className += " file";
         const path = node.path;
+        // Rotated files are listed as members of their log; read them along with it.
+        const family = node.members && node.members.length ? "&family=true" : "";
         
         nodeEl.appendChild(nodeName);
 
@@ -275,15 +293,15 @@ function createNode(node) {
 
         const cat = document.createElement("button");
         cat.textContent = "cat";
-        cat.onclick = () => { stopFollow(); fetchText(`./filesystem/cat?path=${encodePath(path)}`); };
+        cat.onclick = () => { stopFollow(); fetchText(`./filesystem/cat?path=${encodePath(path)}&decompress=true`); };
 
         const head = document.createElement("button");
         head.textContent = "head";
-        head.onclick = () => { stopFollow(); fetchText(`./filesystem/head?path=${encodePath(path)}&lines=${lines.value}`); };
+        head.onclick = () => { stopFollow(); fetchText(`./filesystem/head?path=${encodePath(path)}&lines=${lines.value}${family}`); };
 
         const tail = document.createElement("button");
         tail.textContent = "tail";
-        tail.onclick = () => { stopFollow(); fetchText(`./filesystem/tail?path=${encodePath(path)}&lines=${lines.value}&follow=false`); };
+        tail.onclick = () => { stopFollow(); fetchText(`./filesystem/tail?path=${encodePath(path)}&lines=${lines.value}&follow=false${family}`); };
         
                                 const follow = document.createElement("button");
                                 follow.textContent = "follow";
@@ -291,7 +309,7 @@ function createNode(node) {
                                     stopFollow();
                                     showLoader();
                                     await wrappedRenderOutput(""); // Clear output
-                                    const url = `./filesystem/tail?path=${encodePath(path)}&lines=${lines.value}&follow=true`;
+                                    const url = `./filesystem/tail?path=${encodePath(path)}&lines=${lines.value}&follow=true${family}`;
                                     
                                     try {
                                 const res = await authFetch(url);
@@ -340,7 +358,7 @@ function createNode(node) {
         
                             try {
         
-                                const res = await authFetch(`./filesystem/cat?path=${encodePath(path)}`);
+                                const res = await authFetch(`./filesystem/cat?path=${encodePath(path)}&download=true`);
         
                                 const blob = await res.blob();
         
@@ -378,63 +396,40 @@ function createNode(node) {
         
                         
         
-                                        viewJson.textContent = "View as JSON";
-        
-                        
-        
-                                        viewJson.onclick = async () => {
+                                        viewJson.textContent = "View parsed";
         
                         
         
-                                            stopFollow();
-        
-                        
-        
-                                            showLoader();
-        
-                        
-        
-                                            try {
-        
-                        
-        
-                                                const res = await authFetch(`./filesystem/cat?path=${encodePath(path)}`);
-        
-                        
-        
-                                                const text = await res.text();
-        
-                        
-        
-                                                openJsonViewer(text);
-        
-                        
-        
-                                                        } catch (e) {
-        
-                        
-        
-                                                            output.innerHTML = `Error fetching file for JSON view.\n\n[Error: ${e.message}]`;
-        
-                        
-        
-                                                            hideLoader();
-        
-                        
-        
-                                                        }
-        
-                        
-        
-                                                    };
+                                        viewJson.onclick = () => viewParsed(path, family, 1);
 
-        controls.append(lines, cat, head, tail, follow, download, viewJson);
+        // Only show the actions allowed by the server for this file
+        const can = (op) => !node.ops || node.ops.includes(op);
+        const actions = [
+            [cat, "cat"], [head, "head"], [tail, "tail"],
+            [follow, "follow"], [download, "download"], [viewJson, "parse"],
+        ].filter(([, op]) => can(op)).map(([button]) => button);
+        controls.append(lines, ...actions);
         
         const rightSide = document.createElement('div');
         rightSide.className = 'file-right-side';
         rightSide.appendChild(nodeSize);
         rightSide.appendChild(controls);
         nodeEl.appendChild(rightSide);
+
+        if (family) {
+            // List the rotated files under their log, each with its own actions.
+            const membersEl = document.createElement("div");
+            membersEl.className = "node-children family-members";
+            node.members.forEach(member => membersEl.appendChild(createNode(member)));
+            nodeName.textContent = `${node.name} (+${node.members.length} rotated)`;
+            nodeName.classList.add("family");
+            nodeName.addEventListener("click", () => membersEl.classList.toggle("open"));
+
+            const familyEl = document.createElement("div");
+            familyEl.className = "tree-node family";
+            familyEl.append(nodeEl, membersEl);
+            return familyEl;
+        }
     }
     return nodeEl;
 }
@@ -451,19 +446,59 @@ async function loadFiles() {
 
 // --- JSON Viewer ---
 
-function openJsonViewer(fileContent) {
-    jsonOutput.innerHTML = "";
-    const lines = fileContent.split('\n').filter(line => line.trim() !== "");
-    const jsonObjects = [];
+// Shows the NDJSON records of /filesystem/parse as a table of their fields.
+// Number of lines "View parsed" shows at a time.
+const PARSE_PAGE_LINES = 1000;
 
-    lines.forEach(line => {
-        try {
-            jsonObjects.push(JSON.parse(line));
-        } catch (e) { /* Not a valid JSON line, ignore it. */ }
-    });
+async function viewParsed(path, family, from) {
+    stopFollow();
+    showLoader();
+    const to = from + PARSE_PAGE_LINES - 1;
+    try {
+        const res = await authFetch(`./filesystem/parse?path=${encodePath(path)}&from_line=${from}&to_line=${to}${family}`);
+        const text = await res.text();
+        openJsonViewer(text, from, to, (next) => viewParsed(path, family, next));
+    } catch (e) {
+        output.innerHTML = `Error fetching file for JSON view.\n\n[Error: ${e.message}]`;
+        hideLoader();
+    }
+}
+
+// pagerFor shows which lines of the file a page holds, with buttons to the
+// previous and next pages. The next page exists while the pages are full.
+function pagerFor(from, to, last, load) {
+    const pager = document.createElement('div');
+    pager.className = 'json-pager';
 
+    const prev = document.createElement('button');
+    prev.textContent = "Previous";
+    prev.disabled = from <= 1;
+    prev.onclick = () => load(Math.max(1, from - PARSE_PAGE_LINES));
+
+    const next = document.createElement('button');
+    next.textContent = "Next";
+    next.disabled = last < to;
+    next.onclick = () => load(to + 1);
+
+    const info = document.createElement('span');
+    info.textContent = last < from ? `No lines from line ${from}` : `Lines ${from}-${last}`;
+
+    pager.append(prev, info, next);
+    return pager;
+}
+
+function openJsonViewer(records, from, to, load) {
+    jsonOutput.innerHTML = "";
+    jsonOutput.parentElement.scrollTop = 0;
+    const lines = records.split('\n')
+        .filter(line => line.trim() !== "")
+        .map(line => JSON.parse(line));
+    const last = lines.length ? lines[lines.length - 1].line : from - 1;
+    jsonOutput.appendChild(pagerFor(from, to, last, load));
+
+    const jsonObjects = lines.map(line => line.fields).filter(fields => fields);
     if (jsonObjects.length === 0) {
-        jsonOutput.textContent = "No valid JSON objects found per line in this file.";
+        jsonOutput.appendChild(document.createTextNode("No line of this page could be parsed."));
         jsonViewer.classList.remove("hidden");
         hideLoader();
         return;
@@ -628,13 +663,16 @@ window.addEventListener("load", async () => {
     document.getElementById("search-prev").addEventListener("click", () => navigateSearch(-1));
     document.getElementById("fullscreen-btn").addEventListener("click", toggleFullscreen);
 
-    // Attempt auto-login
-    const user = localStorage.getItem("auth_user");
-    const pass = localStorage.getItem("auth_pass");
+    // Credentials are no longer kept in the browser
+    localStorage.removeItem("auth_user");
+    localStorage.removeItem("auth_pass");
 
-    if (user && pass) {
-        document.getElementById("user").value = user;
-        document.getElementById("pass").value = pass;
-        await login();
+    // Resume an existing session (e.g. after reload or SSO login)
+    const status = await loadAuthStatus();
+    if (status.oidc) {
+        document.getElementById("sso-login").classList.remove("hidden");
+    }
+    if (status.user) {
+        showApp();
     }
 });
\ No newline at end of file
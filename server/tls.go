@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fmotalleb/go-tools/log"
+	"go.uber.org/zap"
+
+	"github.com/fmotalleb/timber/config"
+)
+
+var (
+	// ErrorInvalidClientCA is returned when the client CA bundle contains no certificates.
+	ErrorInvalidClientCA = errors.New("no certificates found in client CA bundle")
+	// ErrorInvalidTLSVersion is returned for an unknown minimum TLS version.
+	ErrorInvalidTLSVersion = errors.New("invalid TLS version")
+	// ErrorUnknownCipher is returned for an unknown cipher suite name.
+	ErrorUnknownCipher = errors.New("unknown cipher suite")
+	// ErrorInvalidReloadInterval is returned when the certificate reload interval is not positive.
+	ErrorInvalidReloadInterval = errors.New("invalid TLS reload interval")
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig builds the TLS configuration of the HTTPS listener.
+// Client certificates are requested, and verified against the client CA bundle, only when one is configured.
+func newTLSConfig(cfg config.TLS, certs *certReloader) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[cfg.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrorInvalidTLSVersion, cfg.MinVersion)
+	}
+	ciphers, err := cipherSuites(cfg.Ciphers)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   ciphers,
+		GetCertificate: certs.GetCertificate,
+	}
+	if cfg.ClientCA == "" {
+		return tlsCfg, nil
+	}
+
+	pem, err := os.ReadFile(cfg.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidClientCA, cfg.ClientCA)
+	}
+	tlsCfg.ClientCAs = pool
+	tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.RequireClientCert {
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsCfg, nil
+}
+
+// cipherSuites maps cipher suite names to their IDs. No names means Go's defaults.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrorUnknownCipher, name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// certReloader serves the TLS certificate and reloads it when its files change.
+type certReloader struct {
+	cfg config.TLS
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	stamp string
+}
+
+// newCertReloader loads the certificate of cfg.
+func newCertReloader(cfg config.TLS) (*certReloader, error) {
+	c := &certReloader{cfg: cfg}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// load reads the certificate and key from disk.
+func (c *certReloader) load() error {
+	stamp, err := c.fileStamp()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.cfg.Cert, c.cfg.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	c.mu.Lock()
+	c.cert, c.stamp = &cert, stamp
+	c.mu.Unlock()
+	return nil
+}
+
+// fileStamp identifies the current version of the certificate and key files.
+func (c *certReloader) fileStamp() (string, error) {
+	stamp := ""
+	for _, name := range []string{c.cfg.Cert, c.cfg.Key} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat TLS certificate: %w", err)
+		}
+		stamp += fmt.Sprintf("%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
+
+// watch reloads the certificate whenever its files change, until ctx is done.
+// A broken certificate is logged and the previous one stays in use.
+func (c *certReloader) watch(ctx context.Context) {
+	logger := log.Of(ctx).Named("TLS")
+	ticker := time.NewTicker(c.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stamp, err := c.fileStamp()
+		c.mu.RLock()
+		changed := stamp != c.stamp
+		c.mu.RUnlock()
+		if err == nil && !changed {
+			continue
+		}
+		if err = c.load(); err != nil {
+			logger.Error("failed to reload TLS certificate", zap.Error(err))
+			continue
+		}
+		logger.Info("reloaded TLS certificate", zap.String("cert", c.cfg.Cert))
+	}
+}
+
+// serverTLS is the TLS configuration of the HTTPS listeners, whose
+// certificate is reloaded in place.
+type serverTLS struct {
+	cfg    config.TLS
+	certs  *certReloader
+	config *tls.Config
+	stop   context.CancelFunc
+}
+
+// newServerTLS loads the certificate, starts watching it for changes until
+// stopped and builds the TLS configuration of the HTTPS listeners.
+func newServerTLS(ctx context.Context, cfg config.TLS) (*serverTLS, error) {
+	if cfg.ReloadInterval <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidReloadInterval, cfg.ReloadInterval)
+	}
+	certs, err := newCertReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := newTLSConfig(cfg, certs)
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := context.WithCancel(ctx)
+	go certs.watch(ctx)
+	return &serverTLS{cfg: cfg, certs: certs, config: tlsCfg, stop: stop}, nil
+}
+
+// reload reads the certificate from disk again, e.g. on SIGHUP.
+// A broken certificate is logged and the previous one stays in use.
+func (t *serverTLS) reload(ctx context.Context) {
+	logger := log.Of(ctx).Named("TLS")
+	if err := t.certs.load(); err != nil {
+		logger.Error("failed to reload TLS certificate", zap.Error(err))
+		return
+	}
+	logger.Info("reloaded TLS certificate", zap.String("cert", t.cfg.Cert))
+}